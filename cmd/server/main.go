@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/thedekerone/shorts-maker/handlers"
@@ -33,8 +35,18 @@ func main() {
 		}
 	}
 
+	jobsDir := os.Getenv("JOBS_DIR")
+	if jobsDir == "" {
+		jobsDir = filepath.Join("data", "jobs")
+	}
+
+	jobStore, err := services.NewFileJobStore(jobsDir)
+	if err != nil {
+		log.Fatal("failed to open job store:", err)
+	}
+
 	mux.HandleFunc("/ping", handlers.HealthCheckHandler)
-	handlers.HandleReplicateRequest(mux, minioClient)
+	handlers.HandleReplicateRequest(mux, minioClient, jobStore)
 
 	log.Fatal(http.ListenAndServe(":8080", mux))
 }
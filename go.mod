@@ -2,21 +2,24 @@ module github.com/thedekerone/shorts-maker
 
 go 1.22.5
 
+require (
+	github.com/google/uuid v1.6.0
+	github.com/minio/minio-go/v7 v7.0.76
+	github.com/replicate/replicate-go v0.23.0
+	github.com/thedekerone/gobra v1.0.11
+	github.com/u2takey/ffmpeg-go v0.5.0
+)
+
 require (
 	github.com/aws/aws-sdk-go v1.55.5 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/go-ini/ini v1.67.0 // indirect
 	github.com/goccy/go-json v0.10.3 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.8 // indirect
 	github.com/minio/md5-simd v1.1.2 // indirect
-	github.com/minio/minio-go/v7 v7.0.76 // indirect
-	github.com/replicate/replicate-go v0.23.0 // indirect
 	github.com/rs/xid v1.6.0 // indirect
-	github.com/thedekerone/gobra v1.0.11 // indirect
-	github.com/u2takey/ffmpeg-go v0.5.0 // indirect
 	github.com/u2takey/go-utils v0.3.1 // indirect
 	golang.org/x/crypto v0.26.0 // indirect
 	golang.org/x/net v0.28.0 // indirect
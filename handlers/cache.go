@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+// modelCache answers repeated model requests, nil when CACHE_BACKEND is not set
+var modelCache *services.Cache
+
+// loadModelCache sets up the cache picked by CACHE_BACKEND, disk keeps the entries
+// under CACHE_DIR and minio in the bucket of objects
+func loadModelCache(objects services.ObjectStore) {
+	var store services.CacheStore
+
+	switch backend := os.Getenv("CACHE_BACKEND"); backend {
+	case "":
+		return
+	case "disk":
+		disk, err := services.NewDiskCacheStore(filepath.Join(services.CacheDir(), "entries"))
+		if err != nil {
+			log.Printf("failed to open the disk cache, model outputs won't be cached: %v", err)
+			return
+		}
+		store = disk
+	case "minio":
+		minioService, ok := objects.(*services.MinioService)
+		if !ok {
+			log.Println("the minio cache needs minio as the object store, model outputs won't be cached")
+			return
+		}
+		store = services.NewMinioCacheStore(minioService.Client)
+	default:
+		log.Printf("unknown CACHE_BACKEND %q, model outputs won't be cached", backend)
+		return
+	}
+
+	cache, err := services.NewCache(store)
+	if err != nil {
+		log.Printf("failed to create the cache, model outputs won't be cached: %v", err)
+		return
+	}
+
+	modelCache = cache
+}
+
+// saveCacheStats adds the hits and misses of this run to the ones of earlier runs of the job
+func saveCacheStats(jobID string, recorder *services.CacheRecorder) {
+	if recorder == nil {
+		return
+	}
+
+	_, err := jobStore.Update(jobID, func(job *models.Job) {
+		if job.Cache == nil {
+			job.Cache = make(map[string]models.CacheStats)
+		}
+		for capability, stats := range recorder.Stats() {
+			total := job.Cache[capability]
+			total.Hits += stats.Hits
+			total.Misses += stats.Misses
+			job.Cache[capability] = total
+		}
+	})
+	if err != nil {
+		log.Printf("failed to save the cache stats of job %s: %v", jobID, err)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+type jobEvent struct {
+	JobID        string            `json:"jobId"`
+	Status       string            `json:"status"`
+	Percent      int               `json:"percent"`
+	URL          string            `json:"url,omitempty"`
+	SubtitleURLs map[string]string `json:"subtitleUrls,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	At           time.Time         `json:"at"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Artifacts    eventArtifacts    `json:"artifacts"`
+	History      []models.JobStage `json:"history"`
+}
+
+// eventArtifacts are the intermediate outputs worth showing while a job renders
+type eventArtifacts struct {
+	Script     string                         `json:"script,omitempty"`
+	Story      *models.PredictionOutputFormat `json:"story,omitempty"`
+	VoiceURL   string                         `json:"voiceUrl,omitempty"`
+	StyleBible *models.StyleBible             `json:"styleBible,omitempty"`
+	Images     []models.ImageWithTimestamp    `json:"images,omitempty"`
+}
+
+var (
+	subscribers      = make(map[string]map[chan jobEvent]struct{})
+	subscribersMutex sync.Mutex
+)
+
+// progressOrder lists every status a successful job goes through, it drives the percent complete
+var progressOrder = func() []string {
+	order := []string{"queued", "creating_providers"}
+	for _, s := range stages {
+		order = append(order, s.name)
+	}
+	return append(order, "generating_presigned_url", "completed")
+}()
+
+func jobProgress(job *models.Job) int {
+	status := job.Status
+	if job.Finished() && job.Status != "completed" {
+		status = job.FailedStage
+	}
+
+	for i, s := range progressOrder {
+		if s == status {
+			return i * 100 / (len(progressOrder) - 1)
+		}
+	}
+
+	return 0
+}
+
+func newJobEvent(job *models.Job) jobEvent {
+	return jobEvent{
+		JobID:        job.ID,
+		Status:       job.Status,
+		Percent:      jobProgress(job),
+		URL:          job.FormattedURL(),
+		SubtitleURLs: job.SubtitleURLs,
+		Error:        job.Error,
+		At:           job.UpdatedAt,
+		CreatedAt:    job.CreatedAt,
+		Artifacts: eventArtifacts{
+			Script:     job.Artifacts.Script,
+			Story:      job.Artifacts.Story,
+			VoiceURL:   remoteURL(job.Artifacts.VoiceURL),
+			StyleBible: job.Artifacts.StyleBible,
+			Images:     remoteImages(job.Artifacts.Images),
+		},
+		History: job.History,
+	}
+}
+
+// remoteURL hides the file:// URLs of merged and cached media, they are paths on the server
+func remoteURL(url string) string {
+	if strings.HasPrefix(url, "file://") {
+		return ""
+	}
+	return url
+}
+
+// remoteImages keeps the timing of every image but only the URLs clients can open
+func remoteImages(images []models.ImageWithTimestamp) []models.ImageWithTimestamp {
+	if images == nil {
+		return nil
+	}
+	public := make([]models.ImageWithTimestamp, len(images))
+	for i, image := range images {
+		public[i] = image
+		public[i].URL = remoteURL(image.URL)
+	}
+	return public
+}
+
+func subscribe(jobID string) chan jobEvent {
+	events := make(chan jobEvent, 16)
+
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+
+	if subscribers[jobID] == nil {
+		subscribers[jobID] = make(map[chan jobEvent]struct{})
+	}
+	subscribers[jobID][events] = struct{}{}
+
+	return events
+}
+
+func unsubscribe(jobID string, events chan jobEvent) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+
+	delete(subscribers[jobID], events)
+	if len(subscribers[jobID]) == 0 {
+		delete(subscribers, jobID)
+	}
+}
+
+func publishJobEvent(job *models.Job) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+
+	if len(subscribers[job.ID]) == 0 {
+		return
+	}
+
+	event := newJobEvent(job)
+	for events := range subscribers[job.ID] {
+		select {
+		case events <- event:
+			continue
+		default:
+		}
+
+		// a slow client misses intermediate updates rather than blocking the pipeline,
+		// but never the last one since the stream only closes once it sees it
+		if job.Finished() {
+			drain(events)
+			events <- event
+		}
+	}
+}
+
+// drain empties a subscriber channel without waiting, only publishers send to it
+// and they hold subscribersMutex so there is room for one event afterwards
+func drain(events chan jobEvent) {
+	for {
+		select {
+		case <-events:
+		default:
+			return
+		}
+	}
+}
+
+// streamJobEvents sends every status change of a job as a Server-Sent Event
+// and closes the stream once the job is finished
+func streamJobEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	jobID := r.PathValue("id")
+
+	// subscribe before reading the job so no transition is lost in between
+	events := subscribe(jobID)
+	defer unsubscribe(jobID, events)
+
+	job, err := jobStore.Get(jobID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Job not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeJobEvent(w, newJobEvent(job)); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	if job.Finished() {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			if err := writeJobEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if event.Status == "completed" || event.Status == "failed" || event.Status == "cancelled" {
+				return
+			}
+		}
+	}
+}
+
+func writeJobEvent(w http.ResponseWriter, event jobEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", len(event.History), event.Status, data)
+	return err
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+func TestPublishJobEventAlwaysDeliversTheLastEvent(t *testing.T) {
+	events := subscribe("slow")
+	defer unsubscribe("slow", events)
+
+	for i := 0; i < cap(events)+4; i++ {
+		publishJobEvent(&models.Job{ID: "slow", Status: "generating_images"})
+	}
+	publishJobEvent(&models.Job{ID: "slow", Status: "completed"})
+
+	var last jobEvent
+	for len(events) > 0 {
+		last = <-events
+	}
+	if last.Status != "completed" {
+		t.Fatalf("expected the completed event to replace the missed updates, got %q", last.Status)
+	}
+}
+
+func TestJobEventHidesServerPaths(t *testing.T) {
+	job := &models.Job{ID: "paths", Artifacts: models.JobArtifacts{
+		VoiceURL: "file:///var/cache/voice.wav",
+		Images:   []models.ImageWithTimestamp{{URL: "file:///var/cache/a.png", Timestamp: 1}, {URL: "https://example.com/b.png"}},
+	}}
+
+	event := newJobEvent(job)
+	if event.Artifacts.VoiceURL != "" || event.Artifacts.Images[0].URL != "" || event.Artifacts.Images[0].Timestamp != 1 {
+		t.Fatalf("expected the file URLs to be hidden, got %+v", event.Artifacts)
+	}
+	if event.Artifacts.Images[1].URL != "https://example.com/b.png" || job.Artifacts.Images[0].URL == "" {
+		t.Fatalf("expected remote URLs to be kept and the job untouched, got %+v", event.Artifacts)
+	}
+}
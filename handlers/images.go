@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/pkg"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+// simplePromptLength caps the prompt of the simplify failure policy, long prompts are what
+// usually trips the safety filters and timeouts of image models
+const simplePromptLength = 200
+
+// getSceneImages generates one image per scene, shown from the start of the scene until the next one.
+// Up to IMAGE_CONCURRENCY scenes are generated at once and each gets IMAGE_RETRIES attempts,
+// what happens to a scene that still fails is decided by failurePolicy. style starts every prompt
+// so the images look like they belong to the same story
+func getSceneImages(ctx context.Context, providers *services.Providers, scenes []models.Scene, script string, style string, imageOptions services.ImageOptions, failurePolicy string) ([]models.ImageWithTimestamp, error) {
+	urls := make([]string, len(scenes))
+	attempts := max(envInt("IMAGE_RETRIES", 2), 0) + 1
+
+	errs, firstErr := forEachParallel(ctx, len(scenes), envInt("IMAGE_CONCURRENCY", 3), failurePolicy == "fail", func(ctx context.Context, i int) error {
+		// the scenes of a structured script already describe what is on screen
+		promptForImage := scenes[i].Visual
+		if promptForImage == "" {
+			promptForImage = imagePrompt(ctx, providers, script, style, scenes[i].Text)
+		}
+
+		url, err := generateImage(ctx, providers, withStyle(promptForImage, style), imageOptions, attempts)
+		if err != nil {
+			return fmt.Errorf("error getting image %d: %w", i+1, err)
+		}
+		urls[i] = url
+		return nil
+	})
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if firstErr != nil {
+		switch failurePolicy {
+		case "reuse":
+			if err := reuseNeighbours(urls, errs); err != nil {
+				return nil, err
+			}
+		case "simplify":
+			for i, err := range errs {
+				if err == nil {
+					continue
+				}
+				log.Printf("%v, trying again with a simpler prompt", err)
+
+				url, err := generateImage(ctx, providers, withStyle(simplePrompt(scenes[i].Text), style), imageOptions, 1)
+				if err != nil {
+					return nil, fmt.Errorf("error getting image %d with a simpler prompt: %w", i+1, err)
+				}
+				urls[i] = url
+			}
+		default:
+			return nil, firstErr
+		}
+	}
+
+	imagesWithTimestamps := make([]models.ImageWithTimestamp, len(scenes))
+	for i, scene := range scenes {
+		imagesWithTimestamps[i] = models.ImageWithTimestamp{
+			URL:       urls[i],
+			Timestamp: scene.Start,
+			Duration:  scene.End - scene.Start,
+		}
+	}
+
+	return imagesWithTimestamps, nil
+}
+
+// generateImage asks for a single image up to attempts times
+func generateImage(ctx context.Context, providers *services.Providers, prompt string, options services.ImageOptions, attempts int) (string, error) {
+	var url string
+
+	err := withRetries(ctx, attempts, func() error {
+		images, err := providers.Images.GetImages(ctx, prompt, 1, options)
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			return errors.New("the model returned no image")
+		}
+		url = images[0]
+		return nil
+	})
+
+	return url, err
+}
+
+// reuseNeighbours fills every failed scene with the image of the closest scene before it,
+// or after it for the first scenes, only failing when no scene got an image
+func reuseNeighbours(urls []string, errs []error) error {
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		log.Printf("%v, reusing a neighbouring image", err)
+
+		for distance := 1; distance < len(urls) && urls[i] == ""; distance++ {
+			if before := i - distance; before >= 0 && errs[before] == nil {
+				urls[i] = urls[before]
+			} else if after := i + distance; after < len(urls) && errs[after] == nil {
+				urls[i] = urls[after]
+			}
+		}
+
+		if urls[i] == "" {
+			return fmt.Errorf("no image could be generated: %w", err)
+		}
+	}
+	return nil
+}
+
+// imagePrompt asks the text model to describe the image for a scene of the script,
+// the scene itself is the prompt when the text model fails
+func imagePrompt(ctx context.Context, providers *services.Providers, script string, style string, sceneText string) string {
+	system := "I have the following story: \n" + script + "\n"
+	if style != "" {
+		system += "All its images follow this art direction: " + style + "\n"
+	}
+	system += "Generate a prompt for an image for this specific part(prompt should describe what is in the image, camera settings, and style according to the overall story) with the context of the story and the specific parts after it: "
+
+	promptForImage, err := providers.Text.
+		GetCompletition(ctx, system+sceneText,
+			"generate a prompt for flux image generation for this part of the story; the prompt should describe exactly what should be in the image, and also the camera settings and style")
+
+	if err != nil {
+		promptForImage = system + sceneText
+	}
+
+	return promptForImage
+}
+
+// simplePrompt is the first sentence of the scene, shortened to simplePromptLength
+func simplePrompt(sceneText string) string {
+	sentences := pkg.SplitSentences(sceneText, simplePromptLength)
+	if len(sentences) == 0 {
+		return "An illustration"
+	}
+	return "An illustration of: " + strings.TrimSpace(sentences[0])
+}
+
+func withStyle(prompt, style string) string {
+	if style != "" {
+		prompt = style + "\n" + prompt
+	}
+	return prompt
+}
+
+// imageStyle is the style bible followed by the style the job asked for
+func imageStyle(bible *models.StyleBible, requested string) string {
+	var style []string
+	if bible != nil && bible.Prompt() != "" {
+		style = append(style, bible.Prompt())
+	}
+	if requested != "" {
+		style = append(style, "Style: "+requested)
+	}
+	return strings.Join(style, "\n")
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+// flakyImages fails every prompt containing "broken" and records how often each prompt was tried
+type flakyImages struct {
+	mu    sync.Mutex
+	tries map[string]int
+}
+
+func (f *flakyImages) GetImages(ctx context.Context, prompt string, quantity int64, options services.ImageOptions) ([]string, error) {
+	f.mu.Lock()
+	f.tries[prompt]++
+	f.mu.Unlock()
+
+	if strings.Contains(prompt, "broken") {
+		return nil, errors.New("safety filter")
+	}
+	return []string{"image:" + prompt}, nil
+}
+
+func TestSceneImagesFailurePolicies(t *testing.T) {
+	retryBackoff = 0
+	t.Setenv("IMAGE_RETRIES", "2")
+
+	scenes := []models.Scene{
+		{Text: "First.", Visual: "one", Start: 0, End: 2},
+		{Text: "Second scene. With more.", Visual: "broken two", Start: 2, End: 5},
+		{Text: "Third.", Visual: "three", Start: 5, End: 6},
+	}
+
+	images := &flakyImages{tries: make(map[string]int)}
+	providers := &services.Providers{Images: images}
+
+	if _, err := getSceneImages(context.Background(), providers, scenes, "", "", services.ImageOptions{}, "fail"); err == nil {
+		t.Fatal("expected the fail policy to fail the job")
+	}
+	if images.tries["broken two"] != 3 {
+		t.Fatalf("expected 3 attempts, got %d", images.tries["broken two"])
+	}
+
+	reused, err := getSceneImages(context.Background(), providers, scenes, "", "", services.ImageOptions{}, "reuse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused[0].URL != "image:one" || reused[1].URL != "image:one" || reused[2].URL != "image:three" {
+		t.Fatalf("expected the first image to be reused in order, got %+v", reused)
+	}
+	if reused[1].Timestamp != 2 || reused[1].Duration != 3 {
+		t.Fatalf("expected the scene timing to be kept, got %+v", reused[1])
+	}
+
+	simplified, err := getSceneImages(context.Background(), providers, scenes, "", "", services.ImageOptions{}, "simplify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simplified[1].URL != "image:An illustration of: Second scene." {
+		t.Fatalf("expected a simpler prompt for the broken scene, got %+v", simplified[1])
+	}
+
+	broken := []models.Scene{{Visual: "broken"}, {Visual: "broken too"}}
+	if _, err := getSceneImages(context.Background(), providers, broken, "", "", services.ImageOptions{}, "reuse"); err == nil {
+		t.Fatal("expected reuse to fail without a single image")
+	}
+}
+
+func TestImagesStageRedoesPrunedFiles(t *testing.T) {
+	var imagesStage stage
+	for _, s := range stages {
+		if s.name == "generating_images" {
+			imagesStage = s
+		}
+	}
+
+	kept := filepath.Join(t.TempDir(), "kept.png")
+	os.WriteFile(kept, []byte("png"), 0o644)
+
+	p := &pipeline{artifacts: models.JobArtifacts{Images: []models.ImageWithTimestamp{{URL: "file://" + kept}, {URL: "https://example.com/b.png"}}}}
+	if !imagesStage.done(p) {
+		t.Fatal("expected images that are still there to be done")
+	}
+
+	p.artifacts.Images = append(p.artifacts.Images, models.ImageWithTimestamp{URL: "file://" + kept + ".pruned"})
+	if imagesStage.done(p) {
+		t.Fatal("expected a pruned image to be generated again")
+	}
+}
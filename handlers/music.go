@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+const maxMusicUploadSize = 20 << 20
+
+var musicLibrary = &services.MusicLibrary{}
+
+// loadMusicLibrary reads MUSIC_DIR, which defaults to the music folder of the assets
+func loadMusicLibrary() {
+	dir := os.Getenv("MUSIC_DIR")
+	if dir == "" {
+		dir = filepath.Join(assetsDir(), "music")
+	}
+
+	library, err := services.LoadMusicLibrary(dir)
+	if err != nil {
+		log.Printf("failed to load music library, only uploaded music is available: %v", err)
+		return
+	}
+
+	musicLibrary = library
+}
+
+// emptyLibraryMessage explains why moods can't be picked before any track was added
+const emptyLibraryMessage = "the music library is empty, add tracks to library.json in MUSIC_DIR or use a track URL or upload"
+
+// handleMusic lists the library on GET, only the tracks of the mood query parameter
+// when it's given, and stores a custom track on POST
+func handleMusic(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tracks := musicLibrary.Tracks
+		if mood := strings.ToLower(r.URL.Query().Get("mood")); mood != "" {
+			if len(musicLibrary.Tracks) == 0 {
+				writeValidationErrors(w, map[string]string{"mood": emptyLibraryMessage})
+				return
+			}
+			tracks = musicLibrary.WithMood(mood)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"tracks": tracks, "moods": musicLibrary.Moods()})
+	case http.MethodPost:
+		uploadMusic(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func uploadMusic(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMusicUploadSize+1<<20)
+	if err := r.ParseMultipartForm(maxMusicUploadSize); err != nil {
+		writeValidationErrors(w, map[string]string{"file": fmt.Sprintf("must be a multipart upload of at most %d MB", maxMusicUploadSize>>20)})
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeValidationErrors(w, map[string]string{"file": "is required"})
+		return
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp("", "music-*")
+	if err != nil {
+		http.Error(w, "Error saving music", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		http.Error(w, "Error saving music", http.StatusInternalServerError)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType := http.DetectContentType(head[:n])
+	if !audioContentType(contentType) {
+		writeValidationErrors(w, map[string]string{"file": "must be an mp3, wav, ogg or m4a audio file"})
+		return
+	}
+
+	id := uuid.New().String()
+	if err := objectStore.PutFile(r.Context(), services.CustomMusicKey(id), tmp.Name(), contentType); err != nil {
+		http.Error(w, "Error uploading music", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"track": services.CustomMusicPrefix + id})
+}
+
+// audioContentType reports whether a sniffed content type is audio ffmpeg can read, m4a files sniff as mp4
+func audioContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "audio/") || contentType == "application/ogg" || contentType == "video/mp4"
+}
+
+// validateMusic checks the track or mood of a generate request against the library and the uploads
+func validateMusic(music models.MusicSpec) map[string]string {
+	errs := make(map[string]string)
+
+	switch {
+	case music.Track == "" || strings.Contains(music.Track, "://"):
+	case strings.HasPrefix(music.Track, services.CustomMusicPrefix):
+		if _, err := uuid.Parse(strings.TrimPrefix(music.Track, services.CustomMusicPrefix)); err != nil {
+			errs["track"] = "unknown custom track"
+		}
+	default:
+		if _, ok := musicLibrary.Get(music.Track); !ok {
+			errs["track"] = "unknown track, see GET /replicate/music"
+		}
+	}
+
+	if music.Track == "" && music.Mood != "" {
+		if len(musicLibrary.Tracks) == 0 {
+			errs["mood"] = emptyLibraryMessage
+		} else if _, ok := musicLibrary.Pick(music.Mood, ""); !ok {
+			errs["mood"] = "no track has this mood, see GET /replicate/music"
+		}
+	}
+
+	return errs
+}
+
+// resolveMusic turns the music of a job into the URL of its track, the job ID seeds the pick by mood
+func resolveMusic(ctx context.Context, music models.MusicSpec, jobID string) (string, error) {
+	if strings.Contains(music.Track, "://") {
+		return music.Track, nil
+	}
+
+	if id, ok := strings.CutPrefix(music.Track, services.CustomMusicPrefix); ok {
+		return objectStore.PresignedURL(ctx, services.CustomMusicKey(id), time.Hour*12)
+	}
+
+	var track services.MusicTrack
+	var ok bool
+	if music.Track != "" {
+		track, ok = musicLibrary.Get(music.Track)
+	} else {
+		track, ok = musicLibrary.Pick(music.Mood, jobID)
+	}
+	if !ok {
+		return "", fmt.Errorf("no music track named %q or with mood %q", music.Track, music.Mood)
+	}
+
+	path, err := filepath.Abs(musicLibrary.Path(track))
+	if err != nil {
+		return "", err
+	}
+	return "file://" + path, nil
+}
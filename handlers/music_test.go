@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+func TestMoodNeedsMusicLibrary(t *testing.T) {
+	musicLibrary = &services.MusicLibrary{}
+
+	if errs := validateMusic(models.MusicSpec{Mood: "calm"}); errs["mood"] != emptyLibraryMessage {
+		t.Fatalf("expected the empty library to be explained, got %v", errs)
+	}
+
+	recorder := httptest.NewRecorder()
+	handleMusic(recorder, httptest.NewRequest(http.MethodGet, "/replicate/music?mood=calm", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handleMusic(recorder, httptest.NewRequest(http.MethodGet, "/replicate/music", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the empty library to be listed, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// retryBackoff is how long withRetries waits after the first failure, tests shorten it
+var retryBackoff = 2 * time.Second
+
+// forEachParallel calls work for every index with at most concurrency calls running at a time and
+// returns the error of each index. With failFast the first error cancels the calls still running or
+// waiting for a slot, and is also returned on its own since the others only report the cancellation
+func forEachParallel(ctx context.Context, count, concurrency int, failFast bool, work func(ctx context.Context, i int) error) ([]error, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, count)
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			errs[i] = work(ctx, i)
+			if errs[i] != nil {
+				once.Do(func() {
+					firstErr = errs[i]
+					if failFast {
+						cancel()
+					}
+				})
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return errs, firstErr
+}
+
+// withRetries calls fn up to attempts times, waiting a little longer after each failure
+func withRetries(ctx context.Context, attempts int, fn func() error) error {
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		if attempt < attempts {
+			select {
+			case <-time.After(time.Duration(attempt) * retryBackoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,578 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/pkg"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+// pipeline holds everything a stage needs while a job is being rendered
+type pipeline struct {
+	job       *models.Job
+	workDir   string
+	providers *services.Providers
+	artifacts models.JobArtifacts
+}
+
+// stage is one checkpointed step of the video generation, done reports whether
+// its output is already among the job artifacts so a retry can skip it
+type stage struct {
+	name   string
+	errMsg string
+	done   func(p *pipeline) bool
+	run    func(ctx context.Context, p *pipeline) error
+}
+
+var stages = []stage{
+	{
+		name:   "generating_script",
+		errMsg: "Error getting completition: ",
+		done:   func(p *pipeline) bool { return p.artifacts.Script != "" },
+		run: func(ctx context.Context, p *pipeline) error {
+			spec := p.job.Spec
+			if spec.Script != "" {
+				p.artifacts.Script = spec.Script
+				return nil
+			}
+
+			prompt := spec.Prompt
+			if spec.Language != "" {
+				prompt += "\n\nWrite the story in " + models.Languages[spec.Language] + "."
+			}
+
+			if spec.ScriptMode == "structured" {
+				story, err := services.GenerateStructuredScript(ctx, p.providers.Text, prompt)
+				if err != nil {
+					return err
+				}
+				p.artifacts.Script = story.Script
+				p.artifacts.Story = story
+				return nil
+			}
+
+			script, err := p.providers.Text.GetCompletition(ctx, prompt, "")
+			if err != nil {
+				return err
+			}
+			p.artifacts.Script = services.CleanScript(script)
+			return nil
+		},
+	},
+	{
+		name:   "generating_voice",
+		errMsg: "Error getting voice: ",
+		// merged and cached voices live on disk
+		done: func(p *pipeline) bool { return p.artifacts.VoiceURL != "" && urlAvailable(p.artifacts.VoiceURL) },
+		run: func(ctx context.Context, p *pipeline) error {
+			speaker, err := resolveVoice(ctx, p.job.Spec.Voice, p.workDir)
+			if err != nil {
+				return err
+			}
+
+			options := services.VoiceOptions{Speaker: speaker, Language: p.job.Spec.Language}
+			voice, err := synthesizeScript(ctx, p.providers.Speech, p.artifacts.Script, options, p.job.Spec.Pause(), p.workDir)
+			p.artifacts.VoiceURL = voice
+			return err
+		},
+	},
+	{
+		name:   "processing_audio",
+		errMsg: "Error processing audio: ",
+		done:   func(p *pipeline) bool { return fileExists(p.artifacts.AudioPath) },
+		run: func(ctx context.Context, p *pipeline) error {
+			spec := p.job.Spec
+			options := pkg.AudioOptions{Loudness: spec.TargetLoudness(), TrimSilence: spec.TrimsSilence(), Tempo: spec.Tempo()}
+
+			path, loudness, err := pkg.ProcessAudio(ctx, p.artifacts.VoiceURL, options, p.workDir)
+			if err != nil {
+				return err
+			}
+
+			p.artifacts.AudioPath = path
+			p.artifacts.Loudness = &loudness
+			return nil
+		},
+	},
+	{
+		name:   "generating_transcription",
+		errMsg: "Error getting transcription: ",
+		done:   func(p *pipeline) bool { return p.artifacts.Transcript != nil },
+		run: func(ctx context.Context, p *pipeline) error {
+			transcript, err := p.providers.Transcriber.GetTranscription(ctx, "file://"+p.artifacts.AudioPath, p.artifacts.Script, p.job.Spec.Language)
+			if err != nil {
+				return err
+			}
+
+			if len(transcript.Segments) == 0 {
+				return errors.New("transcription has no segments")
+			}
+
+			// the ASR only supplies timings, the words come from the script we generated
+			if p.job.Spec.Alignment != "transcription" {
+				aligned := pkg.AlignScript(p.artifacts.Script, *transcript)
+				transcript = &aligned
+			}
+
+			p.artifacts.Transcript = transcript
+			return nil
+		},
+	},
+	{
+		name:   "planning_scenes",
+		errMsg: "Error planning scenes: ",
+		done:   func(p *pipeline) bool { return len(p.artifacts.Scenes) > 0 },
+		run: func(ctx context.Context, p *pipeline) error {
+			var story []models.Scene
+			if p.artifacts.Story != nil {
+				story = p.artifacts.Story.Scenes
+			}
+
+			scenes := pkg.PlanScenes(*p.artifacts.Transcript, p.job.Spec.NumImages, story)
+			if len(scenes) == 0 {
+				return errors.New("transcription has no words to plan scenes from")
+			}
+
+			p.artifacts.Scenes = scenes
+			return nil
+		},
+	},
+	{
+		name:   "generating_style_bible",
+		errMsg: "Error generating style bible: ",
+		done:   func(p *pipeline) bool { return p.artifacts.StyleBible != nil },
+		run: func(ctx context.Context, p *pipeline) error {
+			var preset *models.StylePreset
+			if found, ok := models.Preset(p.job.Spec.StylePreset); ok {
+				preset = &found
+			}
+
+			bible, err := services.GenerateStyleBible(ctx, p.providers.Text, p.artifacts.Script, preset)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// the images can still be made without one, they just drift more
+				log.Printf("job %s: %v, continuing without a style bible", p.job.ID, err)
+				bible = &models.StyleBible{}
+				if preset != nil {
+					bible.ArtStyle, bible.Palette = preset.ArtStyle, preset.Palette
+				}
+			}
+
+			p.artifacts.StyleBible = bible
+			return nil
+		},
+	},
+	{
+		name:   "generating_images",
+		errMsg: "Error getting images: ",
+		done: func(p *pipeline) bool {
+			// cached images live on disk and are pruned after a while
+			for _, image := range p.artifacts.Images {
+				if !urlAvailable(image.URL) {
+					return false
+				}
+			}
+			return len(p.artifacts.Images) > 0
+		},
+		run: func(ctx context.Context, p *pipeline) error {
+			spec := p.job.Spec
+			imageOptions := services.ImageOptions{AspectRatio: spec.RenderProfile().AspectRatio, Seed: spec.Seed}
+			style := imageStyle(p.artifacts.StyleBible, spec.ImageStyle)
+
+			images, err := getSceneImages(ctx, p.providers, p.artifacts.Scenes, p.artifacts.Script, style, imageOptions, spec.ImageFailure)
+			p.artifacts.Images = images
+			return err
+		},
+	},
+	{
+		name:   "creating_subtitle_file",
+		errMsg: "Error creating subtitle file: ",
+		done: func(p *pipeline) bool {
+			if p.job.Spec.SubtitleStyle == "none" {
+				return true
+			}
+			for _, path := range p.artifacts.CaptionPaths {
+				if !fileExists(path) {
+					return false
+				}
+			}
+			return fileExists(p.artifacts.SubtitlesPath) && len(p.artifacts.CaptionPaths) > 0
+		},
+		run: func(ctx context.Context, p *pipeline) error {
+			subtitlesPath := filepath.Join(p.workDir, "subtitles.ass")
+			options := pkg.AssOptions{Style: pkg.SubtitleStyleFor(p.job.Spec.SubtitleStyle, p.job.Spec.SubtitleOverrides)}
+			profile := p.job.Spec.RenderProfile()
+			options.Width, options.Height = profile.Width, profile.Height
+			if p.job.Spec.CaptionMode == "phrase" {
+				options.PhraseWords = p.job.Spec.CaptionWords
+			}
+
+			safeArea := pkg.DefaultSafeArea
+			if p.job.Spec.SafeArea != nil {
+				safeArea = *p.job.Spec.SafeArea
+			}
+			layout, err := pkg.LoadCaptionLayout(fontsDir(), safeArea)
+			if err != nil {
+				return err
+			}
+			options.Layout = layout
+
+			if p.job.Spec.SubtitleTemplate != "" {
+				template, err := loadSubtitleTemplate(ctx, p.job.Spec.SubtitleTemplate, p.workDir)
+				if err != nil {
+					return err
+				}
+				options.Template = template
+			}
+			if err := pkg.CreateAssFile(subtitlesPath, *p.artifacts.Transcript, options); err != nil {
+				return err
+			}
+
+			// sidecar captions for platforms that take them separately from the video
+			captions := map[string]string{
+				"srt": filepath.Join(p.workDir, "subtitles.srt"),
+				"vtt": filepath.Join(p.workDir, "subtitles.vtt"),
+			}
+			if err := pkg.CreateSrtFile(captions["srt"], *p.artifacts.Transcript); err != nil {
+				return err
+			}
+			if err := pkg.CreateVttFile(captions["vtt"], *p.artifacts.Transcript); err != nil {
+				return err
+			}
+
+			p.artifacts.SubtitlesPath = subtitlesPath
+			p.artifacts.CaptionPaths = captions
+			return nil
+		},
+	},
+	{
+		name:   "creating_video_from_images",
+		errMsg: "Error making video: ",
+		done:   func(p *pipeline) bool { return fileExists(p.artifacts.VideoPath) },
+		run: func(ctx context.Context, p *pipeline) error {
+			segments := p.artifacts.Transcript.Segments
+			path, err := pkg.MakeVideoOfImages(ctx, p.artifacts.Images, float32(segments[len(segments)-1].End), p.videoOptions(), p.workDir)
+			p.artifacts.VideoPath = path
+			return err
+		},
+	},
+	{
+		name:   "adding_audio_to_video",
+		errMsg: "Error adding audio to video: ",
+		done:   func(p *pipeline) bool { return fileExists(p.artifacts.OutputPath) },
+		run: func(ctx context.Context, p *pipeline) error {
+			options := p.videoOptions()
+			if music := p.job.Spec.Music; music != nil {
+				url, err := resolveMusic(ctx, *music, p.job.ID)
+				if err != nil {
+					return err
+				}
+				segments := p.artifacts.Transcript.Segments
+				options.Music = &pkg.MusicBed{URL: url, Volume: music.Gain(), Duration: segments[len(segments)-1].End}
+				// the narration is already normalized, only the mix with music needs another pass
+				options.Loudness = p.job.Spec.TargetLoudness()
+			}
+
+			outputPath, err := pkg.AddAudioToVideo(ctx, p.artifacts.VideoPath, "file://"+p.artifacts.AudioPath, p.artifacts.SubtitlesPath, options, p.workDir)
+			p.artifacts.OutputPath = outputPath
+			return err
+		},
+	},
+	{
+		name:   "uploading_to_minio",
+		errMsg: "Error uploading file to Minio: ",
+		done:   func(p *pipeline) bool { return p.artifacts.ObjectName != "" },
+		run: func(ctx context.Context, p *pipeline) error {
+			generatedFileName := fmt.Sprintf("shorts/generated_short_%s%s", p.job.ID, filepath.Ext(p.artifacts.OutputPath))
+
+			// captions go next to the video, the video is uploaded last since it marks the stage as done
+			captionObjects := make(map[string]string)
+			for format, path := range p.artifacts.CaptionPaths {
+				name := fmt.Sprintf("shorts/generated_short_%s.%s", p.job.ID, format)
+				if err := objectStore.PutFile(ctx, name, path, pkg.SubtitleContentTypes[format]); err != nil {
+					return err
+				}
+				captionObjects[format] = name
+			}
+			p.artifacts.CaptionObjects = captionObjects
+
+			err := objectStore.PutFile(ctx, generatedFileName, p.artifacts.OutputPath, pkg.ContentType(p.job.Spec.OutputFormat))
+			if err != nil {
+				return err
+			}
+
+			p.artifacts.ObjectName = generatedFileName
+			return nil
+		},
+	},
+}
+
+func (p *pipeline) videoOptions() pkg.VideoOptions {
+	options := pkg.DefaultVideoOptions
+	profile := p.job.Spec.RenderProfile()
+	options.Width, options.Height, options.Fps = profile.Width, profile.Height, profile.Fps
+	options.Format = p.job.Spec.OutputFormat
+	options.BurnSubtitles = p.job.Spec.SubtitleMode != "sidecar"
+	options.FontsDir = fontsDir()
+	return options
+}
+
+func processVideoGeneration(ctx context.Context, job *models.Job) {
+	p := &pipeline{
+		job:       job,
+		workDir:   jobWorkDir(job.ID),
+		artifacts: job.Artifacts,
+	}
+
+	if err := os.MkdirAll(p.workDir, 0o755); err != nil {
+		failJob(ctx, job.ID, "Error creating work directory: ", err)
+		return
+	}
+
+	updateJobStatus(job.ID, "creating_providers", "", "")
+	providers, err := services.NewProviders(job.Spec.Providers)
+	if err != nil {
+		failJob(ctx, job.ID, "Error creating providers: ", err)
+		return
+	}
+
+	var cacheStats *services.CacheRecorder
+	if modelCache != nil {
+		providers, cacheStats = services.WithCache(providers, modelCache)
+	}
+	p.providers = providers
+
+	for _, s := range stages {
+		if s.done(p) {
+			continue
+		}
+
+		updateJobStatus(job.ID, s.name, "", "")
+
+		if err := s.run(ctx, p); err != nil {
+			saveCacheStats(job.ID, cacheStats)
+			failStage(ctx, job.ID, s, err)
+			return
+		}
+
+		saveArtifacts(job.ID, p.artifacts)
+	}
+	saveCacheStats(job.ID, cacheStats)
+
+	updateJobStatus(job.ID, "generating_presigned_url", "", "")
+	object, err := objectStore.PresignedURL(ctx, p.artifacts.ObjectName, time.Hour*12)
+	if err != nil {
+		failJob(ctx, job.ID, "Error getting presigned url: ", err)
+		return
+	}
+
+	videoSignedURL := publicPath(object)
+
+	subtitleURLs := make(map[string]string)
+	for format, name := range p.artifacts.CaptionObjects {
+		captionURL, err := objectStore.PresignedURL(ctx, name, time.Hour*12)
+		if err != nil {
+			failJob(ctx, job.ID, "Error getting presigned url: ", err)
+			return
+		}
+		subtitleURLs[format] = publicPath(captionURL)
+	}
+
+	_, err = jobStore.Update(job.ID, func(job *models.Job) {
+		if len(subtitleURLs) > 0 {
+			job.SubtitleURLs = subtitleURLs
+		}
+		job.Loudness = p.artifacts.Loudness
+		job.Story = p.artifacts.Story
+	})
+	if err != nil {
+		log.Printf("failed to save the results of job %s: %v", job.ID, err)
+	}
+
+	updateJobStatus(job.ID, "completed", videoSignedURL, "")
+
+	// Clean up intermediate files, they are only kept around for retries
+	os.RemoveAll(p.workDir)
+}
+
+// failJob marks the job as failed, or as cancelled when the failure was caused by its context being cancelled
+func failJob(ctx context.Context, jobID string, message string, err error) {
+	if ctx.Err() != nil {
+		updateJobStatus(jobID, "cancelled", "", "Cancelled by user")
+		removeWorkDir(jobID)
+		return
+	}
+
+	updateJobStatus(jobID, "failed", "", message+err.Error())
+}
+
+// failStage records which stage broke so a retry knows where to resume
+func failStage(ctx context.Context, jobID string, s stage, err error) {
+	_, updateErr := jobStore.Update(jobID, func(job *models.Job) {
+		job.FailedStage = s.name
+	})
+	if updateErr != nil {
+		log.Printf("failed to update job %s: %v", jobID, updateErr)
+	}
+
+	failJob(ctx, jobID, s.errMsg, err)
+}
+
+func saveArtifacts(jobID string, artifacts models.JobArtifacts) {
+	_, err := jobStore.Update(jobID, func(job *models.Job) {
+		job.Artifacts = artifacts
+	})
+
+	if err != nil {
+		log.Printf("failed to save artifacts of job %s: %v", jobID, err)
+	}
+}
+
+// publicPath keeps only the part of a presigned URL from just before the bucket name until the end
+func publicPath(presigned string) string {
+	if i := strings.Index(presigned, "/"+services.Bucket); i >= 0 {
+		return presigned[i:]
+	}
+	return presigned
+}
+
+// assetsDir is where the fonts and other bundled files live, ASSETS_DIR defaults to ./assets
+func assetsDir() string {
+	if dir := os.Getenv("ASSETS_DIR"); dir != "" {
+		return dir
+	}
+	return "assets"
+}
+
+func fontsDir() string {
+	return filepath.Join(assetsDir(), "fonts")
+}
+
+// urlAvailable reports whether a file:// URL still points to a file, other URLs are assumed to work
+func urlAvailable(url string) bool {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return fileExists(path)
+	}
+	return true
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func updateJobStatus(jobID, status, url, errorMsg string) {
+	job, err := jobStore.Update(jobID, func(job *models.Job) {
+		now := time.Now()
+		job.Status = status
+		job.URL = url // Store the original URL
+		job.Error = errorMsg
+		job.UpdatedAt = now
+		job.History = append(job.History, models.JobStage{Status: status, Error: errorMsg, At: now})
+	})
+
+	if err != nil {
+		log.Printf("failed to update job %s: %v", jobID, err)
+		return
+	}
+
+	publishJobEvent(job)
+
+	if job.Finished() {
+		go deliverWebhook(job)
+	}
+}
+
+// recoverJobs puts jobs that were still waiting back in the queue and fails every job
+// that was running when the server stopped, so clients polling for it get a final status
+func recoverJobs() {
+	jobs, err := jobStore.List()
+	if err != nil {
+		log.Printf("failed to list jobs: %v", err)
+		return
+	}
+
+	// List is newest first, requeue oldest first to keep FIFO order
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+
+		if job.Finished() {
+			continue
+		}
+
+		if job.Status == "queued" {
+			if err := jobQueue.Enqueue(job.ID, job.Priority); err == nil {
+				continue
+			}
+		}
+
+		if _, err := jobStore.Update(job.ID, func(j *models.Job) { j.FailedStage = j.Status }); err != nil {
+			log.Printf("failed to update job %s: %v", job.ID, err)
+		}
+
+		updateJobStatus(job.ID, "failed", "", "Interrupted by server restart during "+job.Status)
+	}
+}
+
+func runJob(jobID string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// register before reading the job so a concurrent cancelJob either sees
+	// the cancel function or has already marked the job as cancelled
+	runningJobsMutex.Lock()
+	runningJobs[jobID] = cancel
+	job, err := jobStore.Get(jobID)
+	runningJobsMutex.Unlock()
+
+	defer func() {
+		runningJobsMutex.Lock()
+		delete(runningJobs, jobID)
+		runningJobsMutex.Unlock()
+	}()
+
+	if err != nil {
+		log.Printf("failed to load job %s: %v", jobID, err)
+		return
+	}
+
+	if job.Finished() {
+		return
+	}
+
+	processVideoGeneration(ctx, job)
+}
+
+// loadSubtitleTemplate downloads and parses a user supplied .ass file
+func loadSubtitleTemplate(ctx context.Context, url string, workDir string) (*pkg.AssDocument, error) {
+	path := filepath.Join(workDir, "template.ass")
+	if err := pkg.DownloadFile(ctx, url, path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	template, err := pkg.ParseAss(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subtitle template: %w", err)
+	}
+
+	return template, nil
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/pkg"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+type probeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+	} `json:"streams"`
+}
+
+func TestProcessVideoGenerationEndToEnd(t *testing.T) {
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+
+	tmp := t.TempDir()
+	t.Setenv("ASSETS_DIR", filepath.Join("..", "assets"))
+	t.Setenv("WORK_DIR", filepath.Join(tmp, "work"))
+	t.Setenv("FAKE_PROVIDER_DIR", filepath.Join(tmp, "fake"))
+	t.Setenv("ENABLE_FAKE_PROVIDERS", "1")
+
+	store, err := services.NewFileJobStore(filepath.Join(tmp, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := services.NewMemoryObjectStore()
+	jobStore, objectStore = store, objects
+
+	spec := models.RenderSpec{
+		Prompt:    "a robot in a library",
+		NumImages: 3,
+		Profile:   "vertical_720",
+		Providers: models.ProviderSelection{Text: "fake", Speech: "fake", Transcription: "fake", Images: "fake"},
+	}
+	spec.ApplyDefaults()
+
+	job := &models.Job{ID: "e2e", Status: "queued", Spec: spec, CreatedAt: time.Now()}
+	if err := store.Create(job); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	processVideoGeneration(ctx, job)
+
+	job, err = store.Get("e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "completed" {
+		t.Fatalf("expected job to complete, got %s: %s", job.Status, job.Error)
+	}
+
+	data, contentType, ok := objects.Get(job.Artifacts.ObjectName)
+	if !ok {
+		t.Fatalf("video %s was not uploaded", job.Artifacts.ObjectName)
+	}
+	if contentType != "video/mp4" {
+		t.Fatalf("unexpected content type %s", contentType)
+	}
+
+	for _, format := range []string{"srt", "vtt"} {
+		if job.SubtitleURLs[format] == "" {
+			t.Fatalf("expected a %s subtitle url, got %v", format, job.SubtitleURLs)
+		}
+		if _, _, ok := objects.Get(job.Artifacts.CaptionObjects[format]); !ok {
+			t.Fatalf("%s captions were not uploaded", format)
+		}
+	}
+
+	if job.Loudness == nil || math.Abs(job.Loudness.OutputIntegrated-spec.TargetLoudness()) > 1 {
+		t.Fatalf("expected the narration to be normalized to %.0f LUFS, got %+v", spec.TargetLoudness(), job.Loudness)
+	}
+
+	videoPath := filepath.Join(tmp, "short.mp4")
+	if err := os.WriteFile(videoPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_format", "-show_streams", "-of", "json", videoPath).Output()
+	if err != nil {
+		t.Fatalf("ffprobe rejected the video: %v", err)
+	}
+
+	var probe probeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		t.Fatal(err)
+	}
+
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	// the script is read in chunks of sentences with a pause in between
+	chunks := pkg.SpeechChunks(services.FakeScript, pkg.MaxSpeechChunk)
+	expected := spec.Pause() * float64(len(chunks)-1)
+	for _, chunk := range chunks {
+		expected += services.FakeVoiceDuration(chunk)
+	}
+	if math.Abs(duration-expected) > 0.5 {
+		t.Fatalf("expected a video of about %.2fs, got %.2fs", expected, duration)
+	}
+
+	var codecTypes []string
+	for _, stream := range probe.Streams {
+		codecTypes = append(codecTypes, stream.CodecType)
+	}
+	for _, want := range []string{"video", "audio", "subtitle"} {
+		if !strings.Contains(strings.Join(codecTypes, ","), want) {
+			t.Fatalf("expected a %s stream, got %v", want, codecTypes)
+		}
+	}
+}
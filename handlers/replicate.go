@@ -3,46 +3,55 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 	"github.com/thedekerone/shorts-maker/models"
-	"github.com/thedekerone/shorts-maker/pkg"
 	"github.com/thedekerone/shorts-maker/services"
 )
 
-type Job struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	URL    string `json:"url"`
-	Error  string `json:"error,omitempty"`
-}
-
-func (j Job) FormattedURL() string {
-	return strings.ReplaceAll(j.URL, `\u0026`, "&")
-}
-
 var (
-	jobs      = make(map[string]*Job)
-	jobsMutex sync.RWMutex
+	jobStore    services.JobStore
+	jobQueue    *services.JobQueue
+	objectStore services.ObjectStore
+
+	// cancel functions of the jobs currently running on a worker
+	runningJobs      = make(map[string]context.CancelFunc)
+	runningJobsMutex sync.Mutex
 )
 
-func HandleReplicateRequest(m *http.ServeMux, minioClient *services.MinioService) {
+func HandleReplicateRequest(m *http.ServeMux, objects services.ObjectStore, store services.JobStore) {
 	prefix := "/replicate"
 
+	jobStore = store
+	objectStore = objects
+	jobQueue = services.NewJobQueue(envInt("WORKER_COUNT", 2), envInt("QUEUE_MAX_DEPTH", 20), runJob)
+	loadVoiceCatalog()
+	loadMusicLibrary()
+	loadModelCache(objects)
+	recoverJobs()
+	startWorkDirSweeper()
+
 	println("registering handlers")
 
 	m.HandleFunc(prefix+"/generate-ai-short", enableCORS(generateAIShort))
 	m.HandleFunc(prefix+"/job-status", enableCORS(getJobStatus))
+	m.HandleFunc(prefix+"/jobs", enableCORS(listJobs))
+	m.HandleFunc(prefix+"/jobs/{id}", enableCORS(cancelJob))
+	m.HandleFunc(prefix+"/jobs/{id}/cancel", enableCORS(cancelJob))
+	m.HandleFunc(prefix+"/jobs/{id}/retry", enableCORS(retryJob))
+	m.HandleFunc(prefix+"/jobs/{id}/events", enableCORS(streamJobEvents))
+	m.HandleFunc(prefix+"/voices", enableCORS(handleVoices))
+	m.HandleFunc(prefix+"/music", enableCORS(handleMusic))
+	m.HandleFunc(prefix+"/profiles", enableCORS(handleProfiles))
+	m.HandleFunc(prefix+"/styles", enableCORS(handleStyles))
 	m.HandleFunc(prefix+"/test-sign-url", testSignURL)
 
 	m.HandleFunc(prefix+"/get-completition", handleCompletition)
@@ -78,7 +87,7 @@ func handleCompletition(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	predictions, err := rs.GetCompletition(prompt, "")
+	predictions, err := rs.GetCompletition(r.Context(), prompt, "")
 
 	print(predictions)
 
@@ -127,7 +136,7 @@ func handleGetVoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	voice, err := rs.GetVoice(prompt)
+	voice, err := rs.GetVoice(r.Context(), prompt, services.VoiceOptions{})
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -142,6 +151,28 @@ func handleGetVoice(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(voice)
 }
 
+// handleProfiles lists the render profiles a job can pick
+func handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"profiles": models.RenderProfiles, "default": models.DefaultProfile})
+}
+
+// handleStyles lists the style presets a job can pick
+func handleStyles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"styles": models.StylePresets})
+}
+
 func handleGetImages(w http.ResponseWriter, r *http.Request) {
 	rs, err := services.NewReplicateService()
 
@@ -171,7 +202,7 @@ func handleGetImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	images, err := rs.GetImages(prompt, s)
+	images, err := rs.GetImages(r.Context(), prompt, s, services.ImageOptions{AspectRatio: r.URL.Query().Get("aspect_ratio")})
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -184,43 +215,116 @@ func handleGetImages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(images)
 }
 
+// generateRequest is the body of POST /generate-ai-short: the render spec plus how the job is queued and reported
+type generateRequest struct {
+	models.RenderSpec
+	Priority       string `json:"priority,omitempty"`
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"callback_secret,omitempty"`
+}
+
 func generateAIShort(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is GET
-	if r.Method != http.MethodGet {
+	var req generateRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		// Backward compatible shortcut taking the main options as query parameters
+		query := r.URL.Query()
+		req.Prompt = query.Get("text")
+		req.Script = query.Get("script")
+		req.Voice = query.Get("voice")
+		req.Priority = query.Get("priority")
+		req.CallbackURL = query.Get("callback_url")
+		req.CallbackSecret = query.Get("callback_secret")
+
+		if req.Prompt == "" && req.Script == "" {
+			http.Error(w, "text parameter is required", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if errs := decodeGenerateRequest(w, r, &req); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get the text query parameter
-	text := r.URL.Query().Get("text")
+	req.ApplyDefaults()
+	if req.Priority == "" {
+		req.Priority = services.DefaultPriority
+	}
+
+	errs := req.Validate()
+
+	for field, message := range services.ValidateProviders(req.Providers) {
+		errs[field] = message
+	}
+
+	if msg := validateVoice(r.Context(), req.Voice); msg != "" {
+		errs["voice"] = msg
+	}
+
+	if req.Music != nil {
+		for field, message := range validateMusic(*req.Music) {
+			errs["music."+field] = message
+		}
+	}
 
-	script := r.URL.Query().Get("script")
+	if !services.ValidPriority(req.Priority) {
+		errs["priority"] = "must be one of: " + strings.Join(services.Priorities, ", ")
+	}
 
-	// Validate the text parameter
-	if text == "" && script == "" {
-		http.Error(w, "text parameter is required", http.StatusBadRequest)
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(r.Context(), req.CallbackURL); err != nil {
+			errs["callback_url"] = err.Error()
+		}
+		// deliveries are always signed so receivers can tell them from forged ones
+		if req.CallbackSecret == "" {
+			errs["callback_secret"] = "is required with callback_url"
+		}
+	}
+
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
 		return
 	}
 
 	// Generate a unique job ID
 	jobID := uuid.New().String()
 
-	// Create a new job and store it in the jobs map
-	job := &Job{
-		ID:     jobID,
-		Status: "initialized",
+	// Create a new job and persist it in the job store
+	now := time.Now()
+	job := &models.Job{
+		ID:             jobID,
+		Status:         "queued",
+		Spec:           req.RenderSpec,
+		Priority:       req.Priority,
+		CallbackURL:    req.CallbackURL,
+		CallbackSecret: req.CallbackSecret,
+		History:        []models.JobStage{{Status: "queued", At: now}},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if err := jobStore.Create(job); err != nil {
+		http.Error(w, "Error creating job", http.StatusInternalServerError)
+		return
 	}
 
-	jobsMutex.Lock()
-	jobs[jobID] = job
-	jobsMutex.Unlock()
-
-	// Start the video generation process in a goroutine
-	go processVideoGeneration(jobID, text, script)
+	// Hand the job to the worker pool
+	if err := jobQueue.Enqueue(jobID, req.Priority); err != nil {
+		updateJobStatus(jobID, "failed", "", "Rejected: "+err.Error())
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "too many jobs in progress, try again later", http.StatusServiceUnavailable)
+		return
+	}
 
 	// Prepare the response
-	response := map[string]string{
-		"jobId": jobID,
+	response := map[string]any{
+		"jobId":         jobID,
+		"queuePosition": jobQueue.Position(jobID),
 	}
 
 	// Set the content type header
@@ -234,260 +338,204 @@ func generateAIShort(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func processVideoGeneration(jobID string, text string, script string) {
+func enableCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Set CORS headers
+		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
-	updateJobStatus(jobID, "connecting_to_minio", "", "")
-	minioClient, err := services.ConnectToMinio()
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Couldn't connect to minio: "+err.Error())
-		return
-	}
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 
-	updateJobStatus(jobID, "creating_replicate_service", "", "")
-	rs, err := services.NewReplicateService()
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error creating replicate service: "+err.Error())
-		return
+		// Call the next handler
+		next.ServeHTTP(w, r)
 	}
+}
 
-	updateJobStatus(jobID, "generating_script", "", "")
-
-	var predictions string
+// decodeGenerateRequest reads a JSON render spec, reporting malformed input per field
+func decodeGenerateRequest(w http.ResponseWriter, r *http.Request, req *generateRequest) map[string]string {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
 
-	if script == "" {
-		predictions, err = rs.GetCompletition(text, "")
-	} else {
-		predictions = script
-	}
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error getting completition: "+err.Error())
-		return
+	err := decoder.Decode(req)
+	if err == nil {
+		return nil
 	}
 
-	updateJobStatus(jobID, "generating_voice", "", "")
-	voice, err := rs.GetVoice(predictions)
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error getting voice: "+err.Error())
-		return
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return map[string]string{typeErr.Field: "must be a " + typeErr.Type.String()}
 	}
 
-	updateJobStatus(jobID, "generating_transcription", "", "")
-	transcript, err := rs.GetTranscription(voice, predictions)
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error getting transcription: "+err.Error())
-		return
+	if field, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+		return map[string]string{strings.Trim(field, `"`): "unknown field"}
 	}
 
-	lastSegment := transcript.Segments[len(transcript.Segments)-1]
+	return map[string]string{"body": "invalid JSON: " + err.Error()}
+}
 
-	updateJobStatus(jobID, "generating_images", "", "")
-	images, err := getImagesWithTimestamps(transcript, predictions, 6)
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error getting images: "+err.Error())
-		return
-	}
+func writeValidationErrors(w http.ResponseWriter, errs map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":  "invalid request",
+		"fields": errs,
+	})
+}
 
-	updateJobStatus(jobID, "creating_subtitle_file", "", "")
-	subtitlesPath := filepath.Join(os.TempDir(), fmt.Sprintf("%s.ass", pkg.GenerateRandomString(7)))
-	err = pkg.CreateAssFile(subtitlesPath, *transcript)
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error creating subtitle file: "+err.Error())
+func getJobStatus(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("jobId")
+
+	if jobID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("jobId is required"))
 		return
 	}
 
-	updateJobStatus(jobID, "creating_video_from_images", "", "")
-	path, err := pkg.MakeVideoOfImages(images, float32(lastSegment.End), os.TempDir())
+	job, err := jobStore.Get(jobID)
 
 	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error making video: "+err.Error())
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Job not found"))
 		return
 	}
 
-	updateJobStatus(jobID, "adding_audio_to_video", "", "")
-	outputPath, err := pkg.AddAudioToVideo(path, voice, subtitlesPath, os.TempDir())
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error adding audio to video: "+err.Error())
-		return
-	}
+	job = job.Public()
+	job.QueuePosition = jobQueue.Position(job.ID)
 
-	updateJobStatus(jobID, "preparing_file_for_upload", "", "")
-	file, err := os.Open(outputPath)
-	if err != nil {
-		print(err.Error())
-		updateJobStatus(jobID, "failed", "", "Error opening file: "+err.Error())
-		return
-	}
-	defer file.Close()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error getting file info: "+err.Error())
-		return
-	}
-	fileSize := fileInfo.Size()
-	fileExt := filepath.Ext(fileInfo.Name())
-	generatedFileName := fmt.Sprintf("shorts/generated_short_%s%s", jobID, fileExt)
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := jobStore.List()
 
-	updateJobStatus(jobID, "uploading_to_minio", "", "")
-	_, err = minioClient.Client.PutObject(context.Background(), "shorts-maker", generatedFileName, file, fileSize, minio.PutObjectOptions{ContentType: "video/mp4"})
 	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error uploading file to Minio: "+err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("error listing jobs"))
 		return
 	}
 
-	updateJobStatus(jobID, "generating_presigned_url", "", "")
-	object, err := minioClient.Client.PresignedGetObject(context.Background(), "shorts-maker", generatedFileName, time.Hour*12, nil)
-	if err != nil {
-		updateJobStatus(jobID, "failed", "", "Error getting presigned url: "+err.Error())
-		return
+	for i, job := range jobs {
+		jobs[i] = job.Public()
+		jobs[i].QueuePosition = jobQueue.Position(job.ID)
 	}
 
-	// put only the part from just before the bucket name until the end
-	videoSignedURL := object.String()[strings.Index(object.String(), "/shorts-maker"):]
-
-	updateJobStatus(jobID, "completed", videoSignedURL, "")
-
-	//only path
-	// show only after the url
-
-	// Clean up temporary files
-	os.Remove(outputPath)
-	os.Remove(path)
-	os.Remove(subtitlesPath)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jobs)
 }
 
-func getImagesWithTimestamps(transcript *models.TranscriptionOutput, script string, numImages int32) ([]models.ImageWithTimestamp, error) {
-	rs, err := services.NewReplicateService()
-	if err != nil {
-		return nil, fmt.Errorf("error creating replicate service: %w", err)
+func cancelJob(w http.ResponseWriter, r *http.Request) {
+	allowed := http.MethodDelete
+	if strings.HasSuffix(r.URL.Path, "/cancel") {
+		allowed = http.MethodPost
 	}
 
-	totalDuration := transcript.Segments[len(transcript.Segments)-1].End
-	interval := totalDuration / float64(numImages)
-
-	var imagesWithTimestamps []models.ImageWithTimestamp
-
-	for i := 0; i < int(numImages); i++ {
-		timestamp := float64(i) * interval
-		system := "I have the following story: \n" + script + "\n" + "Generate a prompt for an image for this specific part(prompt should describe what is in the image, camera settings, and style according to the overall story) with the context of the story and the specific parts after it: "
-
-		relevantText := getRelevantText(transcript, timestamp)
-
-		// If relevantText is empty, use the text from the first segment
-		if relevantText == "" && len(transcript.Segments) > 0 {
-			relevantText = transcript.Segments[0].Text
-		}
-
-		promptForImage, err := rs.
-			GetCompletition(system+relevantText,
-				"generate a prompt for flux image generation for this part of the story; the prompt should describe exactly what should be in the image, and also the camera settings and style")
-
-		if err != nil {
-			promptForImage = system + relevantText
-		}
+	if r.Method != allowed {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-		images, err := rs.GetImages(promptForImage, 1)
-		if err != nil {
-			return nil, fmt.Errorf("error getting image %d: %w", i+1, err)
-		}
+	jobID := r.PathValue("id")
 
-		if len(images) > 0 {
-			imagesWithTimestamps = append(imagesWithTimestamps, models.ImageWithTimestamp{
-				URL:       images[0],
-				Timestamp: timestamp,
-			})
-		}
+	job, err := jobStore.Get(jobID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Job not found"))
+		return
 	}
 
-	return imagesWithTimestamps, nil
-}
-
-func getRelevantText(transcript *models.TranscriptionOutput, timestamp float64) string {
-	var relevantText string
-	var currentSegmentIndex int
+	if job.Finished() {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("job already " + job.Status))
+		return
+	}
 
-	// Find the current segment
-	for i, segment := range transcript.Segments {
-		if segment.Start <= timestamp && segment.End > timestamp {
-			currentSegmentIndex = i
-			break
-		}
+	if jobQueue.Remove(jobID) {
+		updateJobStatus(jobID, "cancelled", "", "Cancelled by user")
+		removeWorkDir(jobID)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("cancelled"))
+		return
 	}
 
-	// Get text from the current segment to the start of the next segment (or end of transcript)
-	for i := currentSegmentIndex; i < len(transcript.Segments); i++ {
-		relevantText += transcript.Segments[i].Text + " "
-		if i < len(transcript.Segments)-1 && transcript.Segments[i+1].Start > timestamp {
-			break
-		}
+	runningJobsMutex.Lock()
+	cancel, running := runningJobs[jobID]
+	if running {
+		cancel()
+	} else {
+		// picked from the queue but not started yet, runJob will skip it
+		updateJobStatus(jobID, "cancelled", "", "Cancelled by user")
+		removeWorkDir(jobID)
 	}
+	runningJobsMutex.Unlock()
 
-	return strings.TrimSpace(relevantText)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("cancelling"))
 }
 
-func enableCORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
+// retryJob queues a failed or cancelled job again, the pipeline skips every
+// stage whose artifacts were already saved and resumes from the one that failed
+func retryJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-}
 
-func getJobStatus(w http.ResponseWriter, r *http.Request) {
-	jobID := r.URL.Query().Get("jobId")
+	jobID := r.PathValue("id")
 
-	if jobID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("jobId is required"))
+	job, err := jobStore.Get(jobID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Job not found"))
 		return
 	}
 
-	jobsMutex.RLock()
-	job, exists := jobs[jobID]
-	jobsMutex.RUnlock()
+	if job.Status != "failed" && job.Status != "cancelled" {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("only failed or cancelled jobs can be retried, job is " + job.Status))
+		return
+	}
 
-	if !exists {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte("Job not found"))
+	_, err = jobStore.Update(jobID, func(job *models.Job) {
+		now := time.Now()
+		job.Status = "queued"
+		job.Error = ""
+		job.UpdatedAt = now
+		job.History = append(job.History, models.JobStage{Status: "queued", At: now})
+	})
+	if err != nil {
+		http.Error(w, "Error updating job", http.StatusInternalServerError)
 		return
 	}
 
-	// Create a new struct for the response
-	response := struct {
-		ID     string `json:"id"`
-		Status string `json:"status"`
-		URL    string `json:"url"`
-		Error  string `json:"error,omitempty"`
-	}{
-		ID:     job.ID,
-		Status: job.Status,
-		URL:    job.FormattedURL(),
-		Error:  job.Error,
+	if err := jobQueue.Enqueue(jobID, job.Priority); err != nil {
+		updateJobStatus(jobID, job.Status, "", job.Error)
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "too many jobs in progress, try again later", http.StatusServiceUnavailable)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jobId":         jobID,
+		"resumeFrom":    job.FailedStage,
+		"queuePosition": jobQueue.Position(jobID),
+	})
 }
 
-func updateJobStatus(jobID, status, url, errorMsg string) {
-	jobsMutex.Lock()
-	defer jobsMutex.Unlock()
-
-	if job, exists := jobs[jobID]; exists {
-		job.Status = status
-		job.URL = url // Store the original URL
-		job.Error = errorMsg
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
 	}
+	return value
 }
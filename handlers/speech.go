@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thedekerone/shorts-maker/pkg"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+// synthesizeScript reads the script in chunks of whole sentences so long stories don't get truncated
+// by the TTS model, then merges the chunks into a single WAV in workDir
+func synthesizeScript(ctx context.Context, speech services.SpeechSynthesizer, script string, options services.VoiceOptions, pause float64, workDir string) (string, error) {
+	chunks := pkg.SpeechChunks(script, pkg.MaxSpeechChunk)
+	if len(chunks) <= 1 {
+		return speech.GetVoice(ctx, script, options)
+	}
+
+	urls, err := synthesizeChunks(ctx, speech, chunks, options, envInt("TTS_CONCURRENCY", 3))
+	if err != nil {
+		return "", err
+	}
+
+	merged, err := pkg.MergeAudios(ctx, urls, pause, workDir)
+	if err != nil {
+		return "", err
+	}
+
+	return "file://" + merged, nil
+}
+
+// synthesizeChunks runs at most concurrency GetVoice calls at a time, the first error cancels the rest
+func synthesizeChunks(ctx context.Context, speech services.SpeechSynthesizer, chunks []string, options services.VoiceOptions, concurrency int) ([]string, error) {
+	urls := make([]string, len(chunks))
+
+	_, err := forEachParallel(ctx, len(chunks), concurrency, true, func(ctx context.Context, i int) error {
+		url, err := speech.GetVoice(ctx, chunks[i], options)
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i+1, err)
+		}
+		urls[i] = url
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
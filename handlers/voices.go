@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thedekerone/shorts-maker/pkg"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+const (
+	maxVoiceUploadSize = 10 << 20
+	// XTTS needs a few seconds of clean speech, longer samples don't improve the clone
+	minVoiceDuration = 6.0
+	maxVoiceDuration = 30.0
+	minVoiceRate     = 16000
+)
+
+var voiceCatalog = services.DefaultVoiceCatalog
+
+// loadVoiceCatalog reads VOICES_FILE, which defaults to voices.json in the assets
+func loadVoiceCatalog() {
+	path := os.Getenv("VOICES_FILE")
+	if path == "" {
+		path = filepath.Join(assetsDir(), "voices.json")
+	}
+
+	catalog, err := services.LoadVoiceCatalog(path)
+	if err != nil {
+		log.Printf("failed to load voice catalog, using the default voice: %v", err)
+		return
+	}
+
+	voiceCatalog = catalog
+}
+
+// handleVoices lists the catalog on GET and stores a custom reference WAV on POST
+func handleVoices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"voices": voiceCatalog.Voices})
+	case http.MethodPost:
+		uploadVoice(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func uploadVoice(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxVoiceUploadSize+1<<20)
+	if err := r.ParseMultipartForm(maxVoiceUploadSize); err != nil {
+		writeValidationErrors(w, map[string]string{"file": fmt.Sprintf("must be a multipart upload of at most %d MB", maxVoiceUploadSize>>20)})
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeValidationErrors(w, map[string]string{"file": "is required"})
+		return
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp("", "voice-*.wav")
+	if err != nil {
+		http.Error(w, "Error saving voice", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		http.Error(w, "Error saving voice", http.StatusInternalServerError)
+		return
+	}
+	tmp.Seek(0, io.SeekStart)
+
+	info, err := pkg.ReadWavInfo(tmp)
+	if err != nil {
+		writeValidationErrors(w, map[string]string{"file": err.Error()})
+		return
+	}
+
+	if msg := validateVoiceSample(info); msg != "" {
+		writeValidationErrors(w, map[string]string{"file": msg})
+		return
+	}
+
+	id := uuid.New().String()
+	if err := objectStore.PutFile(r.Context(), services.CustomVoiceKey(id), tmp.Name(), "audio/wav"); err != nil {
+		http.Error(w, "Error uploading voice", http.StatusInternalServerError)
+		return
+	}
+
+	sample, err := objectStore.PresignedURL(r.Context(), services.CustomVoiceKey(id), time.Hour*12)
+	if err != nil {
+		http.Error(w, "Error getting presigned url", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"name":       services.CustomVoicePrefix + id,
+		"duration":   info.Duration,
+		"sample_url": publicPath(sample),
+	})
+}
+
+func validateVoiceSample(info pkg.WavInfo) string {
+	// PCM, IEEE float or WAVE_FORMAT_EXTENSIBLE
+	if info.Format != 1 && info.Format != 3 && info.Format != 0xFFFE {
+		return "must be an uncompressed PCM WAV"
+	}
+	if info.Channels < 1 || info.Channels > 2 {
+		return "must be mono or stereo"
+	}
+	if info.SampleRate < minVoiceRate {
+		return fmt.Sprintf("must have a sample rate of at least %d Hz", minVoiceRate)
+	}
+	if info.Duration < minVoiceDuration || info.Duration > maxVoiceDuration {
+		return fmt.Sprintf("must be between %.0f and %.0f seconds long, got %.1f", minVoiceDuration, maxVoiceDuration, info.Duration)
+	}
+	return ""
+}
+
+// validateVoice checks the voice of a generate request names a catalog or uploaded voice
+func validateVoice(ctx context.Context, voice string) string {
+	if voice == "" || strings.Contains(voice, "://") {
+		return ""
+	}
+
+	if id, ok := strings.CutPrefix(voice, services.CustomVoicePrefix); ok {
+		if _, err := uuid.Parse(id); err != nil {
+			return "unknown custom voice"
+		}
+
+		exists, err := objectStore.Exists(ctx, services.CustomVoiceKey(id))
+		if err != nil {
+			// the voice stage reports it if the store is really broken
+			log.Printf("failed to check custom voice %s: %v", id, err)
+			return ""
+		}
+		if !exists {
+			return "unknown custom voice, upload it with POST /replicate/voices"
+		}
+		return ""
+	}
+
+	if _, ok := voiceCatalog.Get(voice); !ok {
+		return "unknown voice, see GET /replicate/voices"
+	}
+	return ""
+}
+
+// resolveVoice turns the voice of a job into the URL of the reference audio the TTS model clones.
+// Uploaded voices are copied into workDir, the object store is usually not reachable by the
+// TTS provider so it uploads the file itself
+func resolveVoice(ctx context.Context, voice string, workDir string) (string, error) {
+	if voice == "" || strings.Contains(voice, "://") {
+		return voice, nil
+	}
+
+	if id, ok := strings.CutPrefix(voice, services.CustomVoicePrefix); ok {
+		path := filepath.Join(workDir, "voice_sample.wav")
+		if err := objectStore.GetFile(ctx, services.CustomVoiceKey(id), path); err != nil {
+			return "", fmt.Errorf("failed to download custom voice %s: %w", id, err)
+		}
+		return "file://" + path, nil
+	}
+
+	catalogVoice, ok := voiceCatalog.Get(voice)
+	if !ok {
+		return "", fmt.Errorf("unknown voice %s", voice)
+	}
+	return catalogVoice.SampleURL, nil
+}
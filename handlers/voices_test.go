@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+func TestValidateCustomVoiceExists(t *testing.T) {
+	store := services.NewMemoryObjectStore()
+	objectStore = store
+
+	uploaded := uuid.New().String()
+	sample := filepath.Join(t.TempDir(), "voice.wav")
+	os.WriteFile(sample, []byte("RIFF"), 0o644)
+	if err := store.PutFile(context.Background(), services.CustomVoiceKey(uploaded), sample, "audio/wav"); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := validateVoice(context.Background(), services.CustomVoicePrefix+uploaded); msg != "" {
+		t.Fatalf("expected the uploaded voice to be accepted, got %q", msg)
+	}
+	if msg := validateVoice(context.Background(), services.CustomVoicePrefix+uuid.New().String()); msg == "" {
+		t.Fatal("expected a voice that was never uploaded to be rejected")
+	}
+}
+
+func TestResolveCustomVoiceDownloadsSample(t *testing.T) {
+	store := services.NewMemoryObjectStore()
+	objectStore = store
+
+	id := uuid.New().String()
+	sample := filepath.Join(t.TempDir(), "voice.wav")
+	os.WriteFile(sample, []byte("RIFF sample"), 0o644)
+	store.PutFile(context.Background(), services.CustomVoiceKey(id), sample, "audio/wav")
+
+	workDir := t.TempDir()
+	speaker, err := resolveVoice(context.Background(), services.CustomVoicePrefix+id, workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, ok := strings.CutPrefix(speaker, "file://")
+	if !ok || filepath.Dir(path) != workDir {
+		t.Fatalf("expected a file in the work directory for the TTS provider to upload, got %s", speaker)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "RIFF sample" {
+		t.Fatalf("expected the uploaded sample, got %q", data)
+	}
+}
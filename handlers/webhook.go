@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+const (
+	webhookMaxAttempts  = 6
+	webhookInitialDelay = 2 * time.Second
+)
+
+// validateCallbackURL rejects callbacks to hosts on the internal network, the webhook client
+// checks again when it connects in case the host resolves somewhere else by then
+func validateCallbackURL(ctx context.Context, callbackURL string) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || parsed.Hostname() == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return errors.New("callback_url must be an absolute http or https URL")
+	}
+	return services.CheckCallbackHost(ctx, parsed.Hostname())
+}
+
+// deliverWebhook posts the finished job to its callback URL, retrying with
+// exponential backoff and recording every attempt on the job
+func deliverWebhook(job *models.Job) {
+	if job.CallbackURL == "" {
+		return
+	}
+
+	public := job.Public()
+	body, err := json.Marshal(public)
+	if err != nil {
+		log.Printf("failed to encode webhook for job %s: %v", job.ID, err)
+		return
+	}
+
+	event := "job." + job.Status
+	delay := webhookInitialDelay
+
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		statusCode, err := services.PostWebhook(ctx, job.CallbackURL, job.CallbackSecret, event, body)
+		cancel()
+
+		delivery := models.WebhookDelivery{
+			Attempt:    attempt,
+			Event:      event,
+			StatusCode: statusCode,
+			At:         time.Now(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		_, updateErr := jobStore.Update(job.ID, func(j *models.Job) {
+			j.Deliveries = append(j.Deliveries, delivery)
+		})
+		if updateErr != nil {
+			log.Printf("failed to record webhook delivery of job %s: %v", job.ID, updateErr)
+		}
+
+		if err == nil {
+			return
+		}
+
+		if attempt < webhookMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	log.Printf("giving up on webhook for job %s after %d attempts", job.ID, webhookMaxAttempts)
+}
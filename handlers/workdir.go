@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+// workDirSweepInterval is how often leftover work directories are looked for
+const workDirSweepInterval = time.Hour
+
+// workRoot is WORK_DIR, data/work by default
+func workRoot() string {
+	if dir := os.Getenv("WORK_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("data", "work")
+}
+
+func jobWorkDir(jobID string) string {
+	return filepath.Join(workRoot(), jobID)
+}
+
+// removeWorkDir deletes the intermediate files of a job that won't resume from them,
+// a retry regenerates whatever its artifacts pointed to in there
+func removeWorkDir(jobID string) {
+	if err := os.RemoveAll(jobWorkDir(jobID)); err != nil {
+		log.Printf("failed to remove work directory of job %s: %v", jobID, err)
+	}
+}
+
+// workDirTTL is how long the work directory of a failed job is kept so it can be retried,
+// WORK_DIR_TTL defaults to 24h. A retry after that starts over from the saved artifacts
+func workDirTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("WORK_DIR_TTL"))
+	if err != nil || ttl <= 0 {
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// startWorkDirSweeper sweeps the work directories now and then every workDirSweepInterval
+func startWorkDirSweeper() {
+	sweepWorkDirs()
+
+	go func() {
+		for range time.Tick(workDirSweepInterval) {
+			sweepWorkDirs()
+		}
+	}()
+}
+
+// sweepWorkDirs removes the work directories of jobs that no longer exist and of
+// finished jobs that haven't changed within workDirTTL
+func sweepWorkDirs() {
+	entries, err := os.ReadDir(workRoot())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("failed to list work directories: %v", err)
+		}
+		return
+	}
+
+	ttl := workDirTTL()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		job, err := jobStore.Get(entry.Name())
+		if err != nil && !errors.Is(err, services.ErrJobNotFound) {
+			log.Printf("failed to read job %s: %v", entry.Name(), err)
+			continue
+		}
+
+		if job != nil && (!job.Finished() || time.Since(job.UpdatedAt) < ttl) {
+			continue
+		}
+
+		removeWorkDir(entry.Name())
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/services"
+)
+
+func TestSweepWorkDirs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("WORK_DIR", filepath.Join(tmp, "work"))
+	t.Setenv("WORK_DIR_TTL", "1h")
+
+	store, err := services.NewFileJobStore(filepath.Join(tmp, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobStore = store
+
+	old := time.Now().Add(-2 * time.Hour)
+	jobs := []*models.Job{
+		{ID: "old-failure", Status: "failed", UpdatedAt: old},
+		{ID: "recent-failure", Status: "failed", UpdatedAt: time.Now()},
+		{ID: "running", Status: "generating_voice", UpdatedAt: old},
+	}
+	for _, job := range jobs {
+		if err := store.Create(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"old-failure", "recent-failure", "running", "deleted"} {
+		if err := os.MkdirAll(jobWorkDir(id), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sweepWorkDirs()
+
+	for id, kept := range map[string]bool{"old-failure": false, "recent-failure": true, "running": true, "deleted": false} {
+		if fileExists(jobWorkDir(id)) != kept {
+			t.Errorf("expected the work directory of %s to be kept: %v", id, kept)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type Job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	URL      string     `json:"url"`
+	Error    string     `json:"error,omitempty"`
+	Spec     RenderSpec `json:"spec"`
+	Priority string     `json:"priority,omitempty"`
+	// QueuePosition is computed from the live queue when the job is served
+	QueuePosition int `json:"queuePosition,omitempty"`
+	// FailedStage is the pipeline stage a failed or cancelled job stopped at
+	FailedStage    string            `json:"failedStage,omitempty"`
+	CallbackURL    string            `json:"callbackUrl,omitempty"`
+	CallbackSecret string            `json:"callbackSecret,omitempty"`
+	Deliveries     []WebhookDelivery `json:"deliveries,omitempty"`
+	// SubtitleURLs are the sidecar caption files keyed by format (srt, vtt)
+	SubtitleURLs map[string]string `json:"subtitleUrls,omitempty"`
+	// Story is the title, hashtags and upload description of a structured script
+	Story *PredictionOutputFormat `json:"story,omitempty"`
+	// Loudness is what the narration measured before and after normalization
+	Loudness *LoudnessStats `json:"loudness,omitempty"`
+	// Cache counts the model calls answered from the cache, keyed by capability
+	Cache     map[string]CacheStats `json:"cache,omitempty"`
+	Artifacts JobArtifacts          `json:"artifacts"`
+	History   []JobStage            `json:"history"`
+	CreatedAt time.Time             `json:"createdAt"`
+	UpdatedAt time.Time             `json:"updatedAt"`
+}
+
+// JobArtifacts are the checkpointed outputs of each pipeline stage
+type JobArtifacts struct {
+	Script string `json:"script,omitempty"`
+	// Story holds the rest of a structured script
+	Story    *PredictionOutputFormat `json:"story,omitempty"`
+	VoiceURL string                  `json:"voiceUrl,omitempty"`
+	// AudioPath is the normalized and trimmed narration
+	AudioPath  string               `json:"audioPath,omitempty"`
+	Loudness   *LoudnessStats       `json:"loudness,omitempty"`
+	Transcript *TranscriptionOutput `json:"transcript,omitempty"`
+	// StyleBible is the art direction shared by the images
+	StyleBible *StyleBible `json:"styleBible,omitempty"`
+	// Scenes are the planned parts of the narration, one image each
+	Scenes        []Scene              `json:"scenes,omitempty"`
+	Images        []ImageWithTimestamp `json:"images,omitempty"`
+	SubtitlesPath string               `json:"subtitlesPath,omitempty"`
+	// CaptionPaths are the sidecar caption files keyed by format
+	CaptionPaths map[string]string `json:"captionPaths,omitempty"`
+	// CaptionObjects are the uploaded sidecar caption files keyed by format
+	CaptionObjects map[string]string `json:"captionObjects,omitempty"`
+	VideoPath      string            `json:"videoPath,omitempty"`
+	OutputPath     string            `json:"outputPath,omitempty"`
+	ObjectName     string            `json:"objectName,omitempty"`
+}
+
+// LoudnessStats are EBU R128 measurements, integrated loudness in LUFS, true peak in dBTP and range in LU
+type LoudnessStats struct {
+	Target           float64 `json:"target"`
+	InputIntegrated  float64 `json:"inputIntegrated"`
+	InputTruePeak    float64 `json:"inputTruePeak"`
+	InputRange       float64 `json:"inputRange"`
+	OutputIntegrated float64 `json:"outputIntegrated"`
+	OutputTruePeak   float64 `json:"outputTruePeak"`
+	OutputRange      float64 `json:"outputRange"`
+}
+
+// CacheStats counts the model calls that were answered from the cache and those that weren't
+type CacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// WebhookDelivery is one attempt at posting the finished job to its callback URL
+type WebhookDelivery struct {
+	Attempt    int       `json:"attempt"`
+	Event      string    `json:"event"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+type JobStage struct {
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+func (j Job) FormattedURL() string {
+	return strings.ReplaceAll(j.URL, `\u0026`, "&")
+}
+
+// Finished reports whether the job reached a terminal status
+func (j Job) Finished() bool {
+	return j.Status == "completed" || j.Status == "failed" || j.Status == "cancelled"
+}
+
+// Copy returns a job that shares no mutable state with j
+func (j Job) Copy() *Job {
+	c := j
+	c.Spec = j.Spec.Copy()
+	c.History = append([]JobStage(nil), j.History...)
+	c.Artifacts.Images = append([]ImageWithTimestamp(nil), j.Artifacts.Images...)
+	c.Artifacts.Scenes = append([]Scene(nil), j.Artifacts.Scenes...)
+	c.Artifacts.Transcript = j.Artifacts.Transcript.Copy()
+	c.Deliveries = append([]WebhookDelivery(nil), j.Deliveries...)
+	c.SubtitleURLs = copyMap(j.SubtitleURLs)
+	c.Artifacts.CaptionPaths = copyMap(j.Artifacts.CaptionPaths)
+	c.Artifacts.CaptionObjects = copyMap(j.Artifacts.CaptionObjects)
+	c.Story = j.Story.Copy()
+	if j.Cache != nil {
+		c.Cache = make(map[string]CacheStats, len(j.Cache))
+		for capability, stats := range j.Cache {
+			c.Cache[capability] = stats
+		}
+	}
+	c.Artifacts.Story = j.Artifacts.Story.Copy()
+	c.Artifacts.StyleBible = j.Artifacts.StyleBible.Copy()
+	c.Loudness = copyPointer(j.Loudness)
+	c.Artifacts.Loudness = copyPointer(j.Artifacts.Loudness)
+	return &c
+}
+
+// Public returns the job as it is shown to clients, without the callback secret and without
+// the artifacts, which are checkpoints full of paths on the server
+func (j Job) Public() *Job {
+	c := j.Copy()
+	c.URL = j.FormattedURL()
+	c.CallbackSecret = ""
+	c.Artifacts = JobArtifacts{}
+	return c
+}
+
+// copyPointer returns a pointer to a copy of the value p points to, nil stays nil
+func copyPointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
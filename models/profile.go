@@ -0,0 +1,39 @@
+package models
+
+import "fmt"
+
+// RenderProfile is a frame size and aspect ratio a short can be rendered in
+type RenderProfile struct {
+	Name        string `json:"name"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	AspectRatio string `json:"aspect_ratio"`
+	Fps         int    `json:"fps"`
+	Description string `json:"description"`
+}
+
+// DefaultProfile is the full HD vertical video every platform for shorts takes
+const DefaultProfile = "vertical_1080"
+
+var RenderProfiles = []RenderProfile{
+	{Name: "vertical_1080", Width: 1080, Height: 1920, AspectRatio: "9:16", Fps: 30, Description: "TikTok, Reels and Shorts in full HD"},
+	{Name: "vertical_720", Width: 720, Height: 1280, AspectRatio: "9:16", Fps: 30, Description: "TikTok, Reels and Shorts, faster to render"},
+	{Name: "square", Width: 1080, Height: 1080, AspectRatio: "1:1", Fps: 30, Description: "Instagram and Facebook feed"},
+	{Name: "portrait", Width: 1080, Height: 1350, AspectRatio: "4:5", Fps: 30, Description: "Instagram feed, taller than square"},
+	{Name: "landscape", Width: 1920, Height: 1080, AspectRatio: "16:9", Fps: 30, Description: "YouTube and desktop players"},
+}
+
+// Profile looks a render profile up by name
+func Profile(name string) (RenderProfile, bool) {
+	for _, profile := range RenderProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return RenderProfile{}, false
+}
+
+// Resolution is the frame size formatted like the resolution of a render spec
+func (p RenderProfile) Resolution() string {
+	return fmt.Sprintf("%dx%d", p.Width, p.Height)
+}
@@ -24,9 +24,25 @@ type PollPredictionResponse struct {
 	} `json:"urls"`
 }
 
+// PredictionOutputFormat is the JSON the text model answers with in structured script mode
 type PredictionOutputFormat struct {
-	Script string   `json:"script"`
-	Tags   []string `json:"tags"`
+	Title string `json:"title"`
+	// Hook is the opening line, the script starts with it
+	Hook     string   `json:"hook"`
+	Script   string   `json:"script"`
+	Hashtags []string `json:"hashtags"`
+	Scenes   []Scene  `json:"scenes"`
+	// Description is the text to post the short with
+	Description string `json:"description"`
+}
+
+// Scene is a part of the script and what should be on screen while it is read,
+// Start and End are only known once the scene is planned against the narration
+type Scene struct {
+	Text   string  `json:"text"`
+	Visual string  `json:"visual"`
+	Start  float64 `json:"start,omitempty"`
+	End    float64 `json:"end,omitempty"`
 }
 
 type TranscriptionOutput struct {
@@ -34,6 +50,19 @@ type TranscriptionOutput struct {
 	Language string    `json:"language"`
 }
 
+// Copy returns a transcript that shares no segments or words with t, nil stays nil
+func (t *TranscriptionOutput) Copy() *TranscriptionOutput {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.Segments = append([]Segment(nil), t.Segments...)
+	for i := range c.Segments {
+		c.Segments[i].Words = append([]Word(nil), t.Segments[i].Words...)
+	}
+	return &c
+}
+
 type Segment struct {
 	End   float64 `json:"end"`
 	Start float64 `json:"start"`
@@ -49,11 +78,24 @@ type Word struct {
 }
 
 type ImageWithTimestamp struct {
-	URL       string
-	Timestamp float64
+	URL       string  `json:"url"`
+	Timestamp float64 `json:"timestamp"`
+	// Duration is how long the image stays on screen, 0 splits the video evenly
+	Duration float64 `json:"duration,omitempty"`
 }
 
 type ImagePrompt struct {
 	Prompt  string `json:"prompt"`
 	Section string `json:"section"`
 }
+
+// Copy returns a story that shares no slices with o, nil stays nil
+func (o *PredictionOutputFormat) Copy() *PredictionOutputFormat {
+	if o == nil {
+		return nil
+	}
+	c := *o
+	c.Hashtags = append([]string(nil), o.Hashtags...)
+	c.Scenes = append([]Scene(nil), o.Scenes...)
+	return &c
+}
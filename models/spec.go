@@ -0,0 +1,506 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RenderSpec describes everything that can be configured about a generated short
+type RenderSpec struct {
+	Prompt   string `json:"prompt,omitempty"`
+	Script   string `json:"script,omitempty"`
+	Language string `json:"language,omitempty"`
+	// ScriptMode is "plain" for a story only, "structured" to also get a title, hook, hashtags and scenes
+	ScriptMode string `json:"script_mode,omitempty"`
+	// Voice is a catalog name, an uploaded custom:<id> voice or the URL of a reference WAV
+	Voice string `json:"voice,omitempty"`
+	// SentencePause is the silence in seconds between the sentences of a long script, 0.25 when unset
+	SentencePause *float64 `json:"sentence_pause,omitempty"`
+	// Loudness is the integrated loudness target of the narration in LUFS, -14 when unset
+	Loudness *float64 `json:"loudness,omitempty"`
+	// TrimSilence cuts the silence at the start and end of the narration, on when unset
+	TrimSilence *bool `json:"trim_silence,omitempty"`
+	// Speed changes the tempo of the narration without changing its pitch, 1 when unset
+	Speed *float64 `json:"speed,omitempty"`
+	// NumImages is the most scenes the narration is split into, one image each
+	NumImages int `json:"num_images,omitempty"`
+	// ImageFailure is what happens when an image still fails after its retries: "fail" the job,
+	// "reuse" the image of a neighbouring scene or "simplify" the prompt and try once more
+	ImageFailure string `json:"image_failure,omitempty"`
+	ImageStyle   string `json:"image_style,omitempty"`
+	// StylePreset fixes the art style and palette of the images, see StylePresets
+	StylePreset string `json:"style_preset,omitempty"`
+	// Seed makes the images repeatable, every image of the job is generated with it
+	Seed *int64 `json:"seed,omitempty"`
+	// Profile is the name of the render profile, see RenderProfiles
+	Profile string `json:"profile,omitempty"`
+	// Resolution is kept for older clients, it picks the profile with that frame size
+	Resolution    string `json:"resolution,omitempty"`
+	SubtitleStyle string `json:"subtitle_style,omitempty"`
+	// SubtitleTemplate is the URL of an .ass file whose styles replace the preset, its Default style is used
+	SubtitleTemplate string `json:"subtitle_template,omitempty"`
+	// SubtitleOverrides tweak the chosen subtitle style preset
+	SubtitleOverrides *SubtitleOverrides `json:"subtitle_overrides,omitempty"`
+	// SafeArea is the space captions keep from each edge, empty means clear of the usual platform overlays
+	SafeArea     *SafeArea `json:"safe_area,omitempty"`
+	OutputFormat string    `json:"output_format,omitempty"`
+	// CaptionMode is "word" to show one word at a time, "phrase" to show short phrases with the spoken word highlighted
+	CaptionMode string `json:"caption_mode,omitempty"`
+	// CaptionWords is the most words a phrase caption holds
+	CaptionWords int `json:"caption_words,omitempty"`
+	// SubtitleMode is "burned" to draw the subtitles into the video, "sidecar" to only ship caption files
+	SubtitleMode string `json:"subtitle_mode,omitempty"`
+	// Alignment is "script" to subtitle the known script with ASR timings, "transcription" to use the ASR words
+	Alignment string `json:"alignment,omitempty"`
+	// Music adds a background track that is ducked under the narration
+	Music *MusicSpec `json:"music,omitempty"`
+	// Providers overrides the configured provider of each capability for this job
+	Providers ProviderSelection `json:"providers,omitempty"`
+}
+
+// Copy returns a spec that shares no pointers with s
+func (s RenderSpec) Copy() RenderSpec {
+	c := s
+	c.SentencePause = copyPointer(s.SentencePause)
+	c.Loudness = copyPointer(s.Loudness)
+	c.TrimSilence = copyPointer(s.TrimSilence)
+	c.Speed = copyPointer(s.Speed)
+	c.Seed = copyPointer(s.Seed)
+	c.SafeArea = copyPointer(s.SafeArea)
+	if s.SubtitleOverrides != nil {
+		overrides := *s.SubtitleOverrides
+		overrides.Outline = copyPointer(s.SubtitleOverrides.Outline)
+		overrides.MarginV = copyPointer(s.SubtitleOverrides.MarginV)
+		c.SubtitleOverrides = &overrides
+	}
+	if s.Music != nil {
+		music := *s.Music
+		music.Volume = copyPointer(s.Music.Volume)
+		c.Music = &music
+	}
+	return c
+}
+
+// MusicSpec picks the background track of a short
+type MusicSpec struct {
+	// Track is a library track name, an uploaded custom:<id> track or an http URL, empty picks one by Mood
+	Track string `json:"track,omitempty"`
+	Mood  string `json:"mood,omitempty"`
+	// Volume is the gain in dB applied to the track before ducking, -12 when unset
+	Volume *float64 `json:"volume,omitempty"`
+}
+
+// SubtitleOverrides replace single properties of a subtitle style preset, sizes are
+// given for a 1920 pixels tall video and scaled to the render resolution
+type SubtitleOverrides struct {
+	Font         string   `json:"font,omitempty"`
+	FontSize     int      `json:"font_size,omitempty"`
+	PrimaryColor string   `json:"primary_color,omitempty"`
+	OutlineColor string   `json:"outline_color,omitempty"`
+	BackColor    string   `json:"back_color,omitempty"`
+	Outline      *float64 `json:"outline,omitempty"`
+	MarginV      *int     `json:"margin_v,omitempty"`
+	// HighlightColor and HighlightScale (in percent) mark the spoken word in phrase captions
+	HighlightColor string `json:"highlight_color,omitempty"`
+	HighlightScale int    `json:"highlight_scale,omitempty"`
+}
+
+// SafeArea is measured in pixels of a 1920 pixels tall video
+type SafeArea struct {
+	Top    int `json:"top"`
+	Bottom int `json:"bottom"`
+	Left   int `json:"left"`
+	Right  int `json:"right"`
+}
+
+// ProviderSelection names the provider used for each capability, empty means the configured default
+type ProviderSelection struct {
+	Text          string `json:"text,omitempty"`
+	Speech        string `json:"speech,omitempty"`
+	Transcription string `json:"transcription,omitempty"`
+	Images        string `json:"images,omitempty"`
+}
+
+const (
+	MaxPromptLength      = 2000
+	MaxScriptLength      = 10000
+	MaxImageStyleLength  = 300
+	MaxImages            = 20
+	MaxSeed              = 1<<31 - 1
+	MaxFontLength        = 100
+	MaxFontSize          = 400
+	MaxOutline           = 20
+	MaxMarginV           = 1920
+	MaxSafeMargin        = 900
+	MaxSentencePause     = 2
+	DefaultSentencePause = 0.25
+	MinCaptionWords      = 2
+	MaxCaptionWords      = 5
+	MinHighlightScale    = 50
+	MaxHighlightScale    = 200
+	MinLoudness          = -30
+	MaxLoudness          = -9
+	DefaultLoudness      = -14
+	MinSpeed             = 0.5
+	MaxSpeed             = 2
+	MinMusicVolume       = -40
+	MaxMusicVolume       = 6
+	DefaultMusicVolume   = -12
+)
+
+// Languages supported by both the voice and the transcription models
+var Languages = map[string]string{
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"de": "German",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"pl": "Polish",
+	"tr": "Turkish",
+	"ru": "Russian",
+	"nl": "Dutch",
+	"cs": "Czech",
+	"ar": "Arabic",
+	"zh": "Chinese",
+	"hu": "Hungarian",
+	"ko": "Korean",
+	"ja": "Japanese",
+	"hi": "Hindi",
+}
+
+var (
+	SubtitleStyles = []string{"pop", "bottom_third", "outlined_yellow", "boxed", "none"}
+	OutputFormats  = []string{"mp4", "mov", "webm"}
+	SubtitleModes  = []string{"burned", "sidecar"}
+	ScriptModes    = []string{"plain", "structured"}
+	ImageFailures  = []string{"fail", "reuse", "simplify"}
+	CaptionModes   = []string{"word", "phrase"}
+	Alignments     = []string{"script", "transcription"}
+)
+
+// ApplyDefaults fills every optional field that was left empty
+func (s *RenderSpec) ApplyDefaults() {
+	s.Prompt = strings.TrimSpace(s.Prompt)
+	s.Script = strings.TrimSpace(s.Script)
+	s.Language = strings.ToLower(strings.TrimSpace(s.Language))
+
+	if s.NumImages == 0 {
+		s.NumImages = 6
+	}
+	if s.Profile == "" && s.Resolution == "" {
+		s.Profile = DefaultProfile
+	}
+	if s.Profile == "" {
+		for _, profile := range RenderProfiles {
+			if profile.Resolution() == s.Resolution {
+				s.Profile = profile.Name
+				break
+			}
+		}
+	}
+	if profile, ok := Profile(s.Profile); ok && s.Resolution == "" {
+		s.Resolution = profile.Resolution()
+	}
+	// "default" is what jobs used before there were presets
+	if s.SubtitleStyle == "" || s.SubtitleStyle == "default" {
+		s.SubtitleStyle = SubtitleStyles[0]
+	}
+	if s.OutputFormat == "" {
+		s.OutputFormat = "mp4"
+	}
+	if s.CaptionMode == "" {
+		s.CaptionMode = CaptionModes[0]
+	}
+	if s.CaptionWords == 0 {
+		s.CaptionWords = 3
+	}
+	if s.SubtitleMode == "" {
+		s.SubtitleMode = SubtitleModes[0]
+	}
+	if s.Alignment == "" {
+		s.Alignment = Alignments[0]
+	}
+	if s.ScriptMode == "" {
+		s.ScriptMode = ScriptModes[0]
+	}
+	if s.ImageFailure == "" {
+		s.ImageFailure = ImageFailures[0]
+	}
+	if s.Music != nil {
+		s.Music.Mood = strings.ToLower(strings.TrimSpace(s.Music.Mood))
+	}
+}
+
+// Validate returns a message per invalid field, keyed by its JSON name
+func (s RenderSpec) Validate() map[string]string {
+	errs := make(map[string]string)
+
+	if s.Prompt == "" && s.Script == "" {
+		errs["prompt"] = "either prompt or script is required"
+	}
+	if len(s.Prompt) > MaxPromptLength {
+		errs["prompt"] = fmt.Sprintf("must be at most %d characters", MaxPromptLength)
+	}
+	if len(s.Script) > MaxScriptLength {
+		errs["script"] = fmt.Sprintf("must be at most %d characters", MaxScriptLength)
+	}
+
+	if s.Language != "" {
+		if _, ok := Languages[s.Language]; !ok {
+			errs["language"] = "unsupported language code"
+		}
+	}
+
+	// names are checked against the voice catalog by the handler
+	if strings.Contains(s.Voice, "://") && !httpURL(s.Voice) {
+		errs["voice"] = "must be a voice name or an http or https URL of a reference audio file"
+	}
+
+	if s.SubtitleTemplate != "" && !httpURL(s.SubtitleTemplate) {
+		errs["subtitle_template"] = "must be an http or https URL of an .ass file"
+	}
+
+	if s.SentencePause != nil && (*s.SentencePause < 0 || *s.SentencePause > MaxSentencePause) {
+		errs["sentence_pause"] = fmt.Sprintf("must be between 0 and %d seconds", MaxSentencePause)
+	}
+
+	if s.Loudness != nil && (*s.Loudness < MinLoudness || *s.Loudness > MaxLoudness) {
+		errs["loudness"] = fmt.Sprintf("must be between %d and %d LUFS", MinLoudness, MaxLoudness)
+	}
+
+	if s.Speed != nil && (*s.Speed < MinSpeed || *s.Speed > MaxSpeed) {
+		errs["speed"] = fmt.Sprintf("must be between %.1f and %d", MinSpeed, MaxSpeed)
+	}
+
+	if s.NumImages < 1 || s.NumImages > MaxImages {
+		errs["num_images"] = fmt.Sprintf("must be between 1 and %d", MaxImages)
+	}
+
+	if s.StylePreset != "" {
+		if _, ok := Preset(s.StylePreset); !ok {
+			var presets []string
+			for _, preset := range StylePresets {
+				presets = append(presets, preset.Name)
+			}
+			errs["style_preset"] = "must be one of: " + strings.Join(presets, ", ")
+		}
+	}
+
+	if s.Seed != nil && (*s.Seed < 0 || *s.Seed > MaxSeed) {
+		errs["seed"] = fmt.Sprintf("must be between 0 and %d", MaxSeed)
+	}
+
+	if len(s.ImageStyle) > MaxImageStyleLength {
+		errs["image_style"] = fmt.Sprintf("must be at most %d characters", MaxImageStyleLength)
+	}
+
+	var profiles, resolutions []string
+	for _, profile := range RenderProfiles {
+		profiles = append(profiles, profile.Name)
+		resolutions = append(resolutions, profile.Resolution())
+	}
+	if profile, ok := Profile(s.Profile); !ok {
+		if s.Profile == "" {
+			errs["resolution"] = "must be one of: " + strings.Join(resolutions, ", ")
+		} else {
+			errs["profile"] = "must be one of: " + strings.Join(profiles, ", ")
+		}
+	} else if s.Resolution != profile.Resolution() {
+		errs["resolution"] = fmt.Sprintf("does not match the %s profile, leave it out", profile.Name)
+	}
+
+	if !oneOf(s.SubtitleStyle, SubtitleStyles) {
+		errs["subtitle_style"] = "must be one of: " + strings.Join(SubtitleStyles, ", ")
+	}
+
+	if !oneOf(s.OutputFormat, OutputFormats) {
+		errs["output_format"] = "must be one of: " + strings.Join(OutputFormats, ", ")
+	}
+
+	if s.SubtitleOverrides != nil {
+		for field, message := range s.SubtitleOverrides.validate() {
+			errs["subtitle_overrides."+field] = message
+		}
+	}
+
+	if s.SafeArea != nil {
+		margins := map[string]int{"top": s.SafeArea.Top, "bottom": s.SafeArea.Bottom, "left": s.SafeArea.Left, "right": s.SafeArea.Right}
+		for field, margin := range margins {
+			if margin < 0 || margin > MaxSafeMargin {
+				errs["safe_area."+field] = fmt.Sprintf("must be between 0 and %d", MaxSafeMargin)
+			}
+		}
+	}
+
+	if !oneOf(s.CaptionMode, CaptionModes) {
+		errs["caption_mode"] = "must be one of: " + strings.Join(CaptionModes, ", ")
+	}
+	if s.CaptionWords < MinCaptionWords || s.CaptionWords > MaxCaptionWords {
+		errs["caption_words"] = fmt.Sprintf("must be between %d and %d", MinCaptionWords, MaxCaptionWords)
+	}
+
+	if !oneOf(s.SubtitleMode, SubtitleModes) {
+		errs["subtitle_mode"] = "must be one of: " + strings.Join(SubtitleModes, ", ")
+	}
+
+	if !oneOf(s.ImageFailure, ImageFailures) {
+		errs["image_failure"] = "must be one of: " + strings.Join(ImageFailures, ", ")
+	}
+
+	if !oneOf(s.ScriptMode, ScriptModes) {
+		errs["script_mode"] = "must be one of: " + strings.Join(ScriptModes, ", ")
+	}
+
+	if !oneOf(s.Alignment, Alignments) {
+		errs["alignment"] = "must be one of: " + strings.Join(Alignments, ", ")
+	}
+
+	if s.Music != nil {
+		for field, message := range s.Music.validate() {
+			errs["music."+field] = message
+		}
+	}
+
+	return errs
+}
+
+func (o SubtitleOverrides) validate() map[string]string {
+	errs := make(map[string]string)
+
+	if len(o.Font) > MaxFontLength || strings.ContainsAny(o.Font, ",\n") {
+		errs["font"] = fmt.Sprintf("must be at most %d characters without commas", MaxFontLength)
+	}
+	if o.FontSize < 0 || o.FontSize > MaxFontSize {
+		errs["font_size"] = fmt.Sprintf("must be between 1 and %d", MaxFontSize)
+	}
+
+	colors := map[string]string{
+		"primary_color":   o.PrimaryColor,
+		"outline_color":   o.OutlineColor,
+		"back_color":      o.BackColor,
+		"highlight_color": o.HighlightColor,
+	}
+	for field, color := range colors {
+		if color != "" && !ValidColor(color) {
+			errs[field] = "must be a hex color like #RRGGBB or #RRGGBBAA"
+		}
+	}
+
+	if o.Outline != nil && (*o.Outline < 0 || *o.Outline > MaxOutline) {
+		errs["outline"] = fmt.Sprintf("must be between 0 and %d", MaxOutline)
+	}
+	if o.MarginV != nil && (*o.MarginV < 0 || *o.MarginV > MaxMarginV) {
+		errs["margin_v"] = fmt.Sprintf("must be between 0 and %d", MaxMarginV)
+	}
+	if o.HighlightScale != 0 && (o.HighlightScale < MinHighlightScale || o.HighlightScale > MaxHighlightScale) {
+		errs["highlight_scale"] = fmt.Sprintf("must be between %d and %d", MinHighlightScale, MaxHighlightScale)
+	}
+
+	return errs
+}
+
+// ValidColor reports whether color is written as #RRGGBB or #RRGGBBAA
+func ValidColor(color string) bool {
+	hex, ok := strings.CutPrefix(color, "#")
+	if !ok || (len(hex) != 6 && len(hex) != 8) {
+		return false
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pause returns the silence between sentences in seconds
+func (s RenderSpec) Pause() float64 {
+	if s.SentencePause == nil {
+		return DefaultSentencePause
+	}
+	return *s.SentencePause
+}
+
+// TargetLoudness returns the loudness the narration is normalized to in LUFS
+func (s RenderSpec) TargetLoudness() float64 {
+	if s.Loudness == nil {
+		return DefaultLoudness
+	}
+	return *s.Loudness
+}
+
+// TrimsSilence reports whether silence is cut from the ends of the narration
+func (s RenderSpec) TrimsSilence() bool {
+	return s.TrimSilence == nil || *s.TrimSilence
+}
+
+// Tempo returns the speed factor of the narration
+func (s RenderSpec) Tempo() float64 {
+	if s.Speed == nil {
+		return 1
+	}
+	return *s.Speed
+}
+
+// Gain returns the volume of the music track in dB
+func (m MusicSpec) Gain() float64 {
+	if m.Volume == nil {
+		return DefaultMusicVolume
+	}
+	return *m.Volume
+}
+
+// names and moods are checked against the music library by the handler
+func (m MusicSpec) validate() map[string]string {
+	errs := make(map[string]string)
+
+	if m.Track == "" && m.Mood == "" {
+		errs["track"] = "either track or mood is required"
+	}
+	if strings.Contains(m.Track, "://") && !httpURL(m.Track) {
+		errs["track"] = "must be a track name or an http or https URL of an audio file"
+	}
+	if m.Volume != nil && (*m.Volume < MinMusicVolume || *m.Volume > MaxMusicVolume) {
+		errs["volume"] = fmt.Sprintf("must be between %d and %d dB", MinMusicVolume, MaxMusicVolume)
+	}
+
+	return errs
+}
+
+// RenderProfile returns the profile the short is rendered with
+func (s RenderSpec) RenderProfile() RenderProfile {
+	if profile, ok := Profile(s.Profile); ok {
+		return profile
+	}
+
+	// jobs from before there were profiles only have a resolution
+	profile, _ := Profile(DefaultProfile)
+	width, height := s.Dimensions()
+	if width > 0 && height > 0 {
+		profile.Name, profile.Description, profile.Width, profile.Height = "", "", width, height
+	}
+	return profile
+}
+
+// Dimensions returns the width and height encoded in Resolution
+func (s RenderSpec) Dimensions() (int, int) {
+	var width, height int
+	fmt.Sscanf(s.Resolution, "%dx%d", &width, &height)
+	return width, height
+}
+
+func httpURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && parsed.Host != "" && (parsed.Scheme == "http" || parsed.Scheme == "https")
+}
+
+func oneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
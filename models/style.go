@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StylePreset is a named art direction jobs can pick instead of describing one
+type StylePreset struct {
+	Name     string `json:"name"`
+	ArtStyle string `json:"art_style"`
+	Palette  string `json:"palette"`
+}
+
+var StylePresets = []StylePreset{
+	{Name: "anime", ArtStyle: "anime illustration, cel shading, clean line art, expressive faces", Palette: "vibrant saturated colors with soft gradients"},
+	{Name: "photoreal", ArtStyle: "photorealistic cinematic photography, 35mm lens, natural lighting, shallow depth of field", Palette: "natural true to life colors"},
+	{Name: "watercolor", ArtStyle: "watercolor painting, soft washes, visible paper texture, loose brush strokes", Palette: "muted pastel tones"},
+	{Name: "comic", ArtStyle: "western comic book art, bold ink outlines, halftone shading", Palette: "bold primary colors with high contrast"},
+}
+
+// Preset looks a style preset up by name
+func Preset(name string) (StylePreset, bool) {
+	for _, preset := range StylePresets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return StylePreset{}, false
+}
+
+// StyleBible is the art direction shared by every image of a short so they look like one story
+type StyleBible struct {
+	ArtStyle   string      `json:"art_style"`
+	Palette    string      `json:"palette"`
+	Setting    string      `json:"setting"`
+	Characters []Character `json:"characters"`
+}
+
+// Character is someone who appears in more than one image and must look the same in all of them
+type Character struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Prompt is the style bible written as the start of an image prompt
+func (b StyleBible) Prompt() string {
+	var parts []string
+
+	if b.ArtStyle != "" {
+		parts = append(parts, "Art style: "+b.ArtStyle+".")
+	}
+	if b.Palette != "" {
+		parts = append(parts, "Color palette: "+b.Palette+".")
+	}
+	if b.Setting != "" {
+		parts = append(parts, "Setting: "+b.Setting+".")
+	}
+	for _, character := range b.Characters {
+		parts = append(parts, fmt.Sprintf("%s: %s.", character.Name, character.Description))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Copy returns a style bible that shares no slices with b, nil stays nil
+func (b *StyleBible) Copy() *StyleBible {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	c.Characters = append([]Character(nil), b.Characters...)
+	return &c
+}
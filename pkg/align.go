@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// minWordDuration is the shortest time given to a script word the ASR did not hear
+const minWordDuration = 0.1
+
+type scriptWord struct {
+	text    string
+	matched int // index of the ASR word it was aligned to, -1 if none
+}
+
+// AlignScript replaces the recognised words of transcript with the words of script.
+// The ASR output only supplies timings: script words are aligned to the recognised
+// words with an edit distance alignment, words the ASR missed get timings interpolated
+// from their neighbours and extra recognised words are dropped. Segment boundaries
+// follow the ones of the transcript.
+func AlignScript(script string, transcript models.TranscriptionOutput) models.TranscriptionOutput {
+	var heard []models.Word
+	var heardSegment []int
+
+	for i, segment := range transcript.Segments {
+		for _, word := range segment.Words {
+			// whisperx leaves words it can't align (numbers mostly) without timestamps
+			if word.End <= word.Start || normalizeWord(word.Word) == "" {
+				continue
+			}
+			heard = append(heard, word)
+			heardSegment = append(heardSegment, i)
+		}
+	}
+
+	fields, glued := scriptWords(script)
+	if len(fields) == 0 || len(heard) == 0 {
+		return transcript
+	}
+
+	words := alignWords(fields, heard)
+
+	aligned := make([]models.Word, len(words))
+	segmentOf := make([]int, len(words))
+
+	for i, word := range words {
+		aligned[i].Word = word.text
+		if word.matched >= 0 {
+			aligned[i].Start = heard[word.matched].Start
+			aligned[i].End = heard[word.matched].End
+			aligned[i].Score = heard[word.matched].Score
+			segmentOf[i] = heardSegment[word.matched]
+		}
+	}
+
+	interpolateUnmatched(words, aligned, segmentOf, transcript)
+
+	output := models.TranscriptionOutput{Language: transcript.Language}
+
+	for i, word := range aligned {
+		if i == 0 || segmentOf[i] != segmentOf[i-1] {
+			output.Segments = append(output.Segments, models.Segment{Start: word.Start})
+		}
+
+		segment := &output.Segments[len(output.Segments)-1]
+		segment.Words = append(segment.Words, word)
+		segment.End = word.End
+		if segment.Text != "" && !glued[i] {
+			segment.Text += " "
+		}
+		segment.Text += word.Word
+	}
+
+	return output
+}
+
+// scriptWords splits the script into words. Chinese and Japanese are written without
+// spaces so each of their characters is a word, glued reports the words that had no
+// space before them in the script
+func scriptWords(script string) (words []string, glued []bool) {
+	for _, field := range strings.Fields(script) {
+		current, cjk := "", false
+		first := true
+
+		for _, r := range field {
+			// punctuation stays with the word before it, a new word starts at every CJK
+			// character and where latin text follows one
+			newWord := normalizeWord(current) != "" && (isCJK(r) || (cjk && normalizeWord(string(r)) != ""))
+			if newWord {
+				words, glued = append(words, current), append(glued, !first)
+				current, first = "", false
+			}
+
+			current += string(r)
+			if normalizeWord(string(r)) != "" {
+				cjk = isCJK(r)
+			}
+		}
+
+		words, glued = append(words, current), append(glued, !first)
+	}
+
+	return words, glued
+}
+
+// isCJK reports whether r is a Chinese character or Japanese kana
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// alignWords runs a levenshtein alignment between the script and the recognised words,
+// substitutions count as matches since they are usually just misheard words
+func alignWords(fields []string, heard []models.Word) []scriptWord {
+	rows, cols := len(fields)+1, len(heard)+1
+
+	cost := make([][]int, rows)
+	for i := range cost {
+		cost[i] = make([]int, cols)
+		cost[i][0] = i
+	}
+	for j := 0; j < cols; j++ {
+		cost[0][j] = j
+	}
+
+	normalized := make([]string, len(heard))
+	for j, word := range heard {
+		normalized[j] = normalizeWord(word.Word)
+	}
+
+	for i := 1; i < rows; i++ {
+		word := normalizeWord(fields[i-1])
+		for j := 1; j < cols; j++ {
+			substitution := 1
+			if word == normalized[j-1] {
+				substitution = 0
+			}
+
+			cost[i][j] = min(cost[i-1][j-1]+substitution, cost[i-1][j]+1, cost[i][j-1]+1)
+		}
+	}
+
+	words := make([]scriptWord, len(fields))
+	i, j := len(fields), len(heard)
+
+	for i > 0 {
+		switch {
+		case j > 0 && cost[i][j] == cost[i-1][j-1]+boolToInt(normalizeWord(fields[i-1]) != normalized[j-1]):
+			words[i-1] = scriptWord{text: fields[i-1], matched: j - 1}
+			i, j = i-1, j-1
+		case cost[i][j] == cost[i-1][j]+1:
+			words[i-1] = scriptWord{text: fields[i-1], matched: -1}
+			i--
+		default:
+			j--
+		}
+	}
+
+	return words
+}
+
+// interpolateUnmatched spreads runs of unmatched words over the gap between their neighbours,
+// borrowing time from the previous word when the gap is too small
+func interpolateUnmatched(words []scriptWord, aligned []models.Word, segmentOf []int, transcript models.TranscriptionOutput) {
+	end := transcript.Segments[len(transcript.Segments)-1].End
+
+	for i := 0; i < len(words); {
+		if words[i].matched >= 0 {
+			i++
+			continue
+		}
+
+		first := i
+		for i < len(words) && words[i].matched < 0 {
+			i++
+		}
+
+		from, to := first, i // [from, to) is re-timed
+		lo, hi := 0.0, end
+		segment := 0
+
+		if first > 0 {
+			lo = aligned[first-1].End
+			segment = segmentOf[first-1]
+		} else if i < len(words) {
+			segment = segmentOf[i]
+		}
+		if i < len(words) {
+			hi = aligned[i].Start
+		}
+
+		if hi-lo < minWordDuration*float64(to-from) && first > 0 {
+			from = first - 1
+			lo = aligned[from].Start
+		}
+		if hi < lo {
+			hi = lo
+		}
+
+		step := (hi - lo) / float64(to-from)
+		for k := from; k < to; k++ {
+			aligned[k].Start = lo + step*float64(k-from)
+			aligned[k].End = aligned[k].Start + step
+			if k >= first {
+				segmentOf[k] = segment
+			}
+		}
+	}
+}
+
+func normalizeWord(word string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, word)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
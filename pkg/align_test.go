@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+func TestAlignScript(t *testing.T) {
+	transcript := models.TranscriptionOutput{
+		Language: "en",
+		Segments: []models.Segment{
+			{
+				Start: 0.0,
+				End:   2.0,
+				Words: []models.Word{
+					{Start: 0.0, End: 0.4, Word: "the", Score: 0.9},
+					{Start: 0.5, End: 1.0, Word: "robbed", Score: 0.4},
+					{Start: 1.1, End: 1.5, Word: "woke", Score: 0.9},
+					{Start: 1.6, End: 2.0, Word: "up", Score: 0.9},
+				},
+			},
+			{
+				Start: 2.5,
+				End:   4.0,
+				Words: []models.Word{
+					{Start: 2.5, End: 2.9, Word: "it", Score: 0.9},
+					{Start: 3.5, End: 4.0, Word: "books", Score: 0.9},
+					{Start: 4.0, End: 4.0, Word: "2", Score: 0.0},
+				},
+			},
+		},
+	}
+
+	output := AlignScript("The robot woke up. It read books!", transcript)
+
+	expected := []string{"The", "robot", "woke", "up.", "It", "read", "books!"}
+
+	var words []models.Word
+	for _, segment := range output.Segments {
+		words = append(words, segment.Words...)
+	}
+
+	if len(words) != len(expected) {
+		t.Fatalf("expected %d words, got %d: %+v", len(expected), len(words), words)
+	}
+
+	for i, word := range words {
+		if word.Word != expected[i] {
+			t.Errorf("word %d: expected %q, got %q", i, expected[i], word.Word)
+		}
+		if word.End < word.Start {
+			t.Errorf("word %q ends before it starts", word.Word)
+		}
+		if i > 0 && word.Start < words[i-1].End {
+			t.Errorf("word %q overlaps %q", word.Word, words[i-1].Word)
+		}
+	}
+
+	// the misheard word keeps the ASR timing
+	if words[1].Start != 0.5 || words[1].End != 1.0 {
+		t.Errorf("unexpected timing for robot: %+v", words[1])
+	}
+
+	// the word the ASR missed fills the gap between its neighbours
+	if words[5].Start != 2.9 || words[5].End != 3.5 {
+		t.Errorf("unexpected timing for read: %+v", words[5])
+	}
+
+	if len(output.Segments) != 2 || output.Segments[0].Text != "The robot woke up." || output.Segments[1].Text != "It read books!" {
+		t.Fatalf("unexpected segments: %+v", output.Segments)
+	}
+}
+
+func TestAlignScriptWithoutSpaces(t *testing.T) {
+	transcript := models.TranscriptionOutput{
+		Language: "zh",
+		Segments: []models.Segment{
+			{
+				Start: 0.0,
+				End:   1.6,
+				Words: []models.Word{
+					{Start: 0.0, End: 0.4, Word: "我", Score: 0.9},
+					{Start: 0.4, End: 0.8, Word: "用", Score: 0.9},
+					{Start: 0.8, End: 1.2, Word: "iPhone", Score: 0.9},
+					{Start: 1.2, End: 1.6, Word: "拍", Score: 0.9},
+				},
+			},
+		},
+	}
+
+	output := AlignScript("我用iPhone拍。", transcript)
+
+	if len(output.Segments) != 1 {
+		t.Fatalf("unexpected segments: %+v", output.Segments)
+	}
+
+	segment := output.Segments[0]
+	expected := []string{"我", "用", "iPhone", "拍。"}
+	if len(segment.Words) != len(expected) {
+		t.Fatalf("expected %d words, got %+v", len(expected), segment.Words)
+	}
+	for i, word := range segment.Words {
+		if word.Word != expected[i] || word.Start != transcript.Segments[0].Words[i].Start {
+			t.Errorf("word %d: expected %q at %v, got %+v", i, expected[i], transcript.Segments[0].Words[i].Start, word)
+		}
+	}
+
+	if segment.Text != "我用iPhone拍。" {
+		t.Errorf("expected the text without spaces, got %q", segment.Text)
+	}
+}
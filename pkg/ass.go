@@ -3,14 +3,24 @@ package pkg
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
-	"path/filepath"
 
 	"github.com/thedekerone/shorts-maker/models"
 )
 
 func CreateDialogFromWords(segment models.Segment) (string, error) {
-	dialog := ""
+	events, err := wordEvents(segment)
+	if err != nil {
+		return "", err
+	}
+
+	return eventsToDialog(events), nil
+}
+
+// wordEvents shows each word of the segment until the next one is spoken
+func wordEvents(segment models.Segment) ([]Event, error) {
+	var events []Event
 
 	for i, word := range segment.Words {
 		var start float64
@@ -32,104 +42,84 @@ func CreateDialogFromWords(segment models.Segment) (string, error) {
 		}
 
 		if start > end {
-			return "", errors.New("Start time is greater than end time")
+			return nil, errors.New("Start time is greater than end time")
 		}
 
 		if start < 0 {
 			start = 0
 		}
 
-		dialog += fmt.Sprintf("Dialogue: 0,%s,%s,Default,,0000,0000,0000,,%s\n", floatToAssTimeStamp(start), floatToAssTimeStamp(end), word.Word)
+		events = append(events, Event{Start: start, End: end, Style: "Default", Text: []TextPart{{Text: word.Word}}})
 	}
 
-	return dialog, nil
+	return events, nil
 }
 
-func CreateDialog(segment models.Segment) (string, error) {
-	baseAssDialog := fmt.Sprintf("\nDialogue: 0,%s,%s,Default,,0000,0000,0000,,%s", floatToAssTimeStamp(segment.Start), floatToAssTimeStamp(segment.End), GetWordsFromSentence(segment))
-
-	return baseAssDialog, nil
-}
-
-func GetWordsFromSentence(sentence models.Segment) string {
-
-	words := ""
-
-	for i, word := range sentence.Words {
-		if i != len(sentence.Words)-1 {
-			words = words + getWordTiming(word, sentence.Words[i+1].Start-word.End) + " "
-		} else if i == 0 {
-			words = words + getWordTiming(word, word.Start-sentence.Start) + " "
-		} else {
-			words = words + getWordTiming(word, 0) + " "
-		}
+func eventsToDialog(events []Event) string {
+	dialog := ""
+	for _, event := range events {
+		dialog += event.String() + "\n"
 	}
-
-	return words
-
-}
-
-func getWordTiming(word models.Word, offset float64) string {
-	time := int((word.End - word.Start + offset) * 100)
-
-	return fmt.Sprintf("{\\k%d}%s", time, word.Word)
+	return dialog
 }
 
+// floatToAssTimeStamp formats seconds as H:MM:SS.cc
 func floatToAssTimeStamp(time float64) string {
-	// 145.345
-
-	absoluteInteger := int(time) // returns 145
-
-	seconds := float64(absoluteInteger%60) + (time - float64(absoluteInteger))
-
-	absoluteInteger = absoluteInteger - absoluteInteger%60
-
-	minutes := absoluteInteger / 60
-
-	absoluteInteger = absoluteInteger - minutes*60
+	if time < 0 {
+		time = 0
+	}
 
-	hours := absoluteInteger / 3600
+	// 145.345 -> 14535 centiseconds, rounding first so 59.999 doesn't print as 60.00
+	centiseconds := int(math.Round(time * 100))
 
-	return fmt.Sprintf("%d:%02d:%05.2f", hours, minutes, seconds)
+	hours := centiseconds / 360000
+	minutes := centiseconds / 6000 % 60
+	seconds := centiseconds / 100 % 60
 
+	return fmt.Sprintf("%d:%02d:%02d.%02d", hours, minutes, seconds, centiseconds%100)
 }
 
-func CreateAssFile(fileName string, transcription models.TranscriptionOutput) error {
-	baseAssFile, err := os.ReadFile(filepath.Join("assets", "base.ass"))
-
-	if err != nil {
-		return errors.New("Failed to open base ASS file")
-	}
-
-	assFile, err := os.Create(fileName)
-
-	defer assFile.Close()
+// AssOptions control how CreateAssFile lays out the captions
+type AssOptions struct {
+	Style  SubtitleStyle
+	Width  int
+	Height int
+	// PhraseWords groups up to this many words on screen and highlights the spoken one,
+	// 0 shows one word at a time
+	PhraseWords int
+	// Template is a user supplied document whose styles replace the generated ones
+	Template *AssDocument
+	// Layout wraps and shrinks the captions to fit the safe area, nil leaves them as they are
+	Layout *CaptionLayout
+}
 
-	if err != nil {
-		return err
+// CreateAssFile writes the transcription in the given style for a video of options.Width x options.Height
+func CreateAssFile(fileName string, transcription models.TranscriptionOutput, options AssOptions) error {
+	doc := NewAssDocument(options.Style, options.Width, options.Height)
+	if options.Template != nil {
+		doc.MergeStyles(*options.Template)
 	}
 
-	segments := transcription.Segments
-
-	_, err = assFile.Write(baseAssFile)
-
-	if err != nil {
-		return errors.New("failed to write base file into new file")
-	}
+	for _, segment := range transcription.Segments {
+		var events []Event
+		var err error
 
-	for _, segment := range segments {
-		dialog, err := CreateDialogFromWords(segment)
+		if options.PhraseWords > 0 {
+			events, err = phraseEvents(segment, options.PhraseWords, options.Style)
+		} else {
+			events, err = wordEvents(segment)
+		}
 
 		if err != nil {
 			return errors.New("failed to create dialog format")
 		}
-		_, err = assFile.Write([]byte(dialog))
 
-		if err != nil {
-			return errors.New("failed to write dialog format")
-		}
+		doc.Events = append(doc.Events, events...)
 	}
 
-	return nil
+	if options.Layout != nil {
+		options.Layout.Apply(doc)
+	}
 
+	return os.WriteFile(fileName, []byte(doc.String()), 0o644)
 }
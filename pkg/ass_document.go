@@ -0,0 +1,557 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// wordJoiner follows a literal backslash so renderers don't read it as the start of \N, \h or a tag
+const wordJoiner = "\u2060"
+
+// AssDocument is a parsed or generated Advanced SubStation Alpha file
+type AssDocument struct {
+	Info   ScriptInfo
+	Styles []Style
+	Events []Event
+	// Sections keeps the sections this package doesn't model (fonts, graphics, editor state) for round trips
+	Sections []RawSection
+}
+
+// ScriptInfo is the [Script Info] section, keys that aren't modelled are kept in Extra
+type ScriptInfo struct {
+	Title                 string
+	ScriptType            string
+	WrapStyle             int
+	PlayResX              int
+	PlayResY              int
+	ScaledBorderAndShadow bool
+	YCbCrMatrix           string
+	Extra                 []InfoField
+}
+
+type InfoField struct {
+	Key   string
+	Value string
+}
+
+// Style is one line of the [V4+ Styles] section, colours are in the &HAABBGGRR notation
+type Style struct {
+	Name            string
+	Fontname        string
+	Fontsize        float64
+	PrimaryColour   string
+	SecondaryColour string
+	OutlineColour   string
+	BackColour      string
+	Bold            bool
+	Italic          bool
+	Underline       bool
+	StrikeOut       bool
+	ScaleX          float64
+	ScaleY          float64
+	Spacing         float64
+	Angle           float64
+	BorderStyle     int
+	Outline         float64
+	Shadow          float64
+	Alignment       int
+	MarginL         int
+	MarginR         int
+	MarginV         int
+	Encoding        int
+}
+
+// Event is a Dialogue or Comment line of the [Events] section, Start and End are in seconds
+type Event struct {
+	Comment bool
+	Layer   int
+	Start   float64
+	End     float64
+	Style   string
+	Name    string
+	MarginL int
+	MarginR int
+	MarginV int
+	Effect  string
+	Text    []TextPart
+}
+
+// TextPart is a run of plain text drawn with the override tags in Tags, e.g. `\1c&H00E0FF&`.
+// Text is escaped when the event is written, a newline becomes \N
+type TextPart struct {
+	Tags string
+	Text string
+}
+
+type RawSection struct {
+	Name  string
+	Lines []string
+}
+
+const (
+	styleFormat = "Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding"
+	eventFormat = "Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text"
+)
+
+// Plain returns the event text without override tags
+func (e Event) Plain() string {
+	text := ""
+	for _, part := range e.Text {
+		text += part.Text
+	}
+	return text
+}
+
+// String writes the document in the ASS file format
+func (d AssDocument) String() string {
+	var out strings.Builder
+
+	out.WriteString("[Script Info]\n")
+	writeInfo := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&out, "%s: %s\n", key, value)
+		}
+	}
+	writeInfo("Title", d.Info.Title)
+	writeInfo("ScriptType", d.Info.ScriptType)
+	fmt.Fprintf(&out, "WrapStyle: %d\n", d.Info.WrapStyle)
+	fmt.Fprintf(&out, "PlayResX: %d\n", d.Info.PlayResX)
+	fmt.Fprintf(&out, "PlayResY: %d\n", d.Info.PlayResY)
+	if d.Info.ScaledBorderAndShadow {
+		writeInfo("ScaledBorderAndShadow", "yes")
+	} else {
+		writeInfo("ScaledBorderAndShadow", "no")
+	}
+	writeInfo("YCbCr Matrix", d.Info.YCbCrMatrix)
+	for _, field := range d.Info.Extra {
+		writeInfo(field.Key, field.Value)
+	}
+
+	out.WriteString("\n[V4+ Styles]\n")
+	out.WriteString("Format: " + styleFormat + "\n")
+	for _, style := range d.Styles {
+		out.WriteString(style.String() + "\n")
+	}
+
+	for _, section := range d.Sections {
+		fmt.Fprintf(&out, "\n[%s]\n", section.Name)
+		for _, line := range section.Lines {
+			out.WriteString(line + "\n")
+		}
+	}
+
+	out.WriteString("\n[Events]\n")
+	out.WriteString("Format: " + eventFormat + "\n")
+	for _, event := range d.Events {
+		out.WriteString(event.String() + "\n")
+	}
+
+	return out.String()
+}
+
+func (s Style) String() string {
+	return "Style: " + strings.Join([]string{
+		stripField(s.Name),
+		stripField(s.Fontname),
+		formatFloat(s.Fontsize),
+		s.PrimaryColour,
+		s.SecondaryColour,
+		s.OutlineColour,
+		s.BackColour,
+		assBool(s.Bold),
+		assBool(s.Italic),
+		assBool(s.Underline),
+		assBool(s.StrikeOut),
+		formatFloat(s.ScaleX),
+		formatFloat(s.ScaleY),
+		formatFloat(s.Spacing),
+		formatFloat(s.Angle),
+		strconv.Itoa(s.BorderStyle),
+		formatFloat(s.Outline),
+		formatFloat(s.Shadow),
+		strconv.Itoa(s.Alignment),
+		strconv.Itoa(s.MarginL),
+		strconv.Itoa(s.MarginR),
+		strconv.Itoa(s.MarginV),
+		strconv.Itoa(s.Encoding),
+	}, ",")
+}
+
+func (e Event) String() string {
+	kind := "Dialogue"
+	if e.Comment {
+		kind = "Comment"
+	}
+
+	text := ""
+	for _, part := range e.Text {
+		if part.Tags != "" {
+			text += "{" + strings.NewReplacer("{", "", "}", "").Replace(part.Tags) + "}"
+		}
+		text += EscapeAssText(part.Text)
+	}
+
+	return fmt.Sprintf("%s: %d,%s,%s,%s,%s,%04d,%04d,%04d,%s,%s", kind, e.Layer, floatToAssTimeStamp(e.Start), floatToAssTimeStamp(e.End), stripField(e.Style), stripField(e.Name), e.MarginL, e.MarginR, e.MarginV, stripField(e.Effect), text)
+}
+
+// EscapeAssText makes plain text safe to place in an event: braces can't open override blocks,
+// a backslash can't start \N or \h and newlines become \N
+func EscapeAssText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\`+wordJoiner,
+		"{", `\{`,
+		"}", `\}`,
+		"\r\n", `\N`,
+		"\n", `\N`,
+	).Replace(text)
+}
+
+// UnescapeAssText reverses EscapeAssText, \h becomes a non-breaking space
+func UnescapeAssText(text string) string {
+	return strings.NewReplacer(
+		`\`+wordJoiner, `\`,
+		`\{`, "{",
+		`\}`, "}",
+		`\N`, "\n",
+		`\n`, "\n",
+		`\h`, "\u00a0",
+	).Replace(text)
+}
+
+// ParseAss reads an ASS document, lines it doesn't understand in known sections are skipped
+func ParseAss(r io.Reader) (*AssDocument, error) {
+	doc := &AssDocument{}
+	section := ""
+	var styleFields, eventFields []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.ToLower(trimmed[1 : len(trimmed)-1])
+			if section != "script info" && section != "v4+ styles" && section != "v4 styles" && section != "events" {
+				doc.Sections = append(doc.Sections, RawSection{Name: trimmed[1 : len(trimmed)-1]})
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+
+		switch section {
+		case "script info":
+			if strings.HasPrefix(trimmed, ";") || !ok {
+				continue
+			}
+			doc.Info.set(strings.TrimSpace(key), value)
+
+		case "v4+ styles", "v4 styles":
+			switch strings.TrimSpace(key) {
+			case "Format":
+				styleFields = splitFormat(value)
+			case "Style":
+				if styleFields == nil {
+					styleFields = splitFormat(styleFormat)
+				}
+				style, err := parseStyle(styleFields, value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				doc.Styles = append(doc.Styles, style)
+			}
+
+		case "events":
+			kind := strings.TrimSpace(key)
+			switch kind {
+			case "Format":
+				eventFields = splitFormat(value)
+			case "Dialogue", "Comment":
+				if eventFields == nil {
+					eventFields = splitFormat(eventFormat)
+				}
+				// the text is the last field and may contain commas, only the raw value keeps its spaces
+				_, raw, _ := strings.Cut(line, ":")
+				event, err := parseEvent(eventFields, strings.TrimPrefix(raw, " "))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				event.Comment = kind == "Comment"
+				doc.Events = append(doc.Events, event)
+			}
+
+		default:
+			if len(doc.Sections) > 0 {
+				last := &doc.Sections[len(doc.Sections)-1]
+				last.Lines = append(last.Lines, line)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// MergeStyles adds the styles of other to the document, replacing the ones with the same name.
+// Sizes are rescaled when the two documents have a different PlayResY
+func (d *AssDocument) MergeStyles(other AssDocument) {
+	scale := 1.0
+	if other.Info.PlayResY > 0 && d.Info.PlayResY > 0 {
+		scale = float64(d.Info.PlayResY) / float64(other.Info.PlayResY)
+	}
+
+	for _, style := range other.Styles {
+		style.Fontsize = math.Round(style.Fontsize*scale*100) / 100
+		style.Outline = math.Round(style.Outline*scale*100) / 100
+		style.Shadow = math.Round(style.Shadow*scale*100) / 100
+		style.MarginL = int(float64(style.MarginL) * scale)
+		style.MarginR = int(float64(style.MarginR) * scale)
+		style.MarginV = int(float64(style.MarginV) * scale)
+
+		replaced := false
+		for i := range d.Styles {
+			if d.Styles[i].Name == style.Name {
+				d.Styles[i] = style
+				replaced = true
+			}
+		}
+		if !replaced {
+			d.Styles = append(d.Styles, style)
+		}
+	}
+}
+
+func (info *ScriptInfo) set(key, value string) {
+	switch key {
+	case "Title":
+		info.Title = value
+	case "ScriptType":
+		info.ScriptType = value
+	case "WrapStyle":
+		info.WrapStyle, _ = strconv.Atoi(value)
+	case "PlayResX":
+		info.PlayResX, _ = strconv.Atoi(value)
+	case "PlayResY":
+		info.PlayResY, _ = strconv.Atoi(value)
+	case "ScaledBorderAndShadow":
+		info.ScaledBorderAndShadow = strings.EqualFold(value, "yes")
+	case "YCbCr Matrix":
+		info.YCbCrMatrix = value
+	default:
+		info.Extra = append(info.Extra, InfoField{Key: key, Value: value})
+	}
+}
+
+func parseStyle(fields []string, value string) (Style, error) {
+	values := strings.Split(value, ",")
+	if len(values) != len(fields) {
+		return Style{}, fmt.Errorf("style has %d fields, the format has %d", len(values), len(fields))
+	}
+
+	style := Style{ScaleX: 100, ScaleY: 100, BorderStyle: 1}
+	var err error
+
+	for i, field := range fields {
+		v := strings.TrimSpace(values[i])
+
+		switch field {
+		case "Name":
+			style.Name = v
+		case "Fontname":
+			style.Fontname = v
+		case "Fontsize":
+			style.Fontsize, err = strconv.ParseFloat(v, 64)
+		case "PrimaryColour":
+			style.PrimaryColour = v
+		case "SecondaryColour":
+			style.SecondaryColour = v
+		case "OutlineColour", "TertiaryColour":
+			style.OutlineColour = v
+		case "BackColour":
+			style.BackColour = v
+		case "Bold":
+			style.Bold = v != "0"
+		case "Italic":
+			style.Italic = v != "0"
+		case "Underline":
+			style.Underline = v != "0"
+		case "StrikeOut":
+			style.StrikeOut = v != "0"
+		case "ScaleX":
+			style.ScaleX, err = strconv.ParseFloat(v, 64)
+		case "ScaleY":
+			style.ScaleY, err = strconv.ParseFloat(v, 64)
+		case "Spacing":
+			style.Spacing, err = strconv.ParseFloat(v, 64)
+		case "Angle":
+			style.Angle, err = strconv.ParseFloat(v, 64)
+		case "BorderStyle":
+			style.BorderStyle, err = strconv.Atoi(v)
+		case "Outline":
+			style.Outline, err = strconv.ParseFloat(v, 64)
+		case "Shadow":
+			style.Shadow, err = strconv.ParseFloat(v, 64)
+		case "Alignment":
+			style.Alignment, err = strconv.Atoi(v)
+		case "MarginL":
+			style.MarginL, err = strconv.Atoi(v)
+		case "MarginR":
+			style.MarginR, err = strconv.Atoi(v)
+		case "MarginV":
+			style.MarginV, err = strconv.Atoi(v)
+		case "Encoding":
+			style.Encoding, err = strconv.Atoi(v)
+		}
+
+		if err != nil {
+			return Style{}, fmt.Errorf("invalid %s %q in style %s", field, v, style.Name)
+		}
+	}
+
+	return style, nil
+}
+
+func parseEvent(fields []string, value string) (Event, error) {
+	values := strings.SplitN(value, ",", len(fields))
+	if len(values) != len(fields) {
+		return Event{}, fmt.Errorf("event has %d fields, the format has %d", len(values), len(fields))
+	}
+
+	var event Event
+	var err error
+
+	for i, field := range fields {
+		v := values[i]
+		if field != "Text" {
+			v = strings.TrimSpace(v)
+		}
+
+		switch field {
+		case "Layer":
+			event.Layer, err = strconv.Atoi(v)
+		case "Start":
+			event.Start, err = parseAssTimeStamp(v)
+		case "End":
+			event.End, err = parseAssTimeStamp(v)
+		case "Style":
+			event.Style = v
+		case "Name", "Actor":
+			event.Name = v
+		case "MarginL":
+			event.MarginL, err = strconv.Atoi(v)
+		case "MarginR":
+			event.MarginR, err = strconv.Atoi(v)
+		case "MarginV":
+			event.MarginV, err = strconv.Atoi(v)
+		case "Effect":
+			event.Effect = v
+		case "Text":
+			event.Text = parseEventText(v)
+		}
+
+		if err != nil {
+			return Event{}, fmt.Errorf("invalid %s %q", field, v)
+		}
+	}
+
+	return event, nil
+}
+
+// parseEventText splits text into runs that start at each override block
+func parseEventText(text string) []TextPart {
+	var parts []TextPart
+	var part TextPart
+	var plain strings.Builder
+
+	flush := func() {
+		part.Text = UnescapeAssText(plain.String())
+		if part.Tags != "" || part.Text != "" {
+			parts = append(parts, part)
+		}
+		part = TextPart{}
+		plain.Reset()
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text):
+			plain.WriteString(text[i : i+2])
+			i++
+		case text[i] == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				plain.WriteString(text[i:])
+				i = len(text)
+				continue
+			}
+			flush()
+			part.Tags = text[i+1 : i+end]
+			i += end
+		default:
+			plain.WriteByte(text[i])
+		}
+	}
+	flush()
+
+	return parts
+}
+
+// parseAssTimeStamp reads H:MM:SS.cc into seconds
+func parseAssTimeStamp(value string) (float64, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(hours*3600+minutes*60) + seconds, nil
+}
+
+func splitFormat(format string) []string {
+	fields := strings.Split(format, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// stripField removes the characters that would shift the comma separated fields
+func stripField(value string) string {
+	return strings.NewReplacer(",", "", "\n", "", "\r", "").Replace(value)
+}
+
+func assBool(value bool) string {
+	if value {
+		return "-1"
+	}
+	return "0"
+}
@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const templateAss = `[Script Info]
+; Script generated by Aegisub
+Title: Template
+ScriptType: v4.00+
+PlayResX: 1280
+PlayResY: 720
+ScaledBorderAndShadow: yes
+Video Zoom: 4
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Comic Sans MS,30,&H000094E0,&H000000FF,&H00FFFFFF,&H00000000,-1,0,0,0,100,100,0,0,1,3,3,5,20,20,30,1
+Style: Title,Arial,48,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,0,8,10,10,15,1
+
+[Aegisub Project Garbage]
+Active Line: 2
+
+[Events]
+Format: Layer, Start, End, Style, Actor, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0000,0000,0000,,{\b1}Hello,{\r} world\Nagain
+Comment: 0,1:02:05.00,1:02:06.25,Title,,0000,0000,0000,,a note
+`
+
+func TestParseAssTemplate(t *testing.T) {
+	doc, err := ParseAss(strings.NewReader(templateAss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Info.Title != "Template" || doc.Info.PlayResX != 1280 || doc.Info.PlayResY != 720 || !doc.Info.ScaledBorderAndShadow {
+		t.Fatalf("unexpected script info: %+v", doc.Info)
+	}
+
+	if len(doc.Styles) != 2 || doc.Styles[0].Fontname != "Comic Sans MS" || !doc.Styles[0].Bold || doc.Styles[1].Alignment != 8 {
+		t.Fatalf("unexpected styles: %+v", doc.Styles)
+	}
+
+	if len(doc.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(doc.Events))
+	}
+
+	expectedText := []TextPart{{Tags: `\b1`, Text: "Hello,"}, {Tags: `\r`, Text: " world\nagain"}}
+	if !reflect.DeepEqual(doc.Events[0].Text, expectedText) {
+		t.Fatalf("unexpected text: %+v", doc.Events[0].Text)
+	}
+
+	if !doc.Events[1].Comment || doc.Events[1].Start != 3725 || doc.Events[1].End != 3726.25 {
+		t.Fatalf("unexpected comment: %+v", doc.Events[1])
+	}
+
+	reparsed, err := ParseAss(strings.NewReader(doc.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc, reparsed) {
+		t.Fatalf("document changed after a round trip:\n%+v\n%+v", doc, reparsed)
+	}
+}
+
+func TestAssEventEscapesText(t *testing.T) {
+	event := Event{
+		Start: 3599.999,
+		End:   3725.5,
+		Style: "Default",
+		Text:  []TextPart{{Text: `a {\b1} word\Nwith \h tricks`}},
+	}
+
+	line := event.String()
+
+	if !strings.HasPrefix(line, "Dialogue: 0,1:00:00.00,1:02:05.50,Default,") {
+		t.Fatalf("unexpected timestamps: %s", line)
+	}
+
+	doc := AssDocument{Info: ScriptInfo{PlayResX: 720, PlayResY: 1280}, Events: []Event{event}}
+	parsed, err := ParseAss(strings.NewReader(doc.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed.Events) != 1 || parsed.Events[0].Plain() != event.Plain() {
+		t.Fatalf("text did not survive a round trip: %s", line)
+	}
+
+	for _, part := range parsed.Events[0].Text {
+		if part.Tags != "" {
+			t.Fatalf("escaped text was read as override tags: %s", line)
+		}
+	}
+}
+
+func TestMergeStylesRescales(t *testing.T) {
+	template, err := ParseAss(strings.NewReader(templateAss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := NewAssDocument(DefaultSubtitleStyle, 1080, 1920)
+	doc.MergeStyles(*template)
+
+	if len(doc.Styles) != 2 {
+		t.Fatalf("expected the template to replace Default and add Title, got %+v", doc.Styles)
+	}
+
+	if doc.Styles[0].Fontname != "Comic Sans MS" || doc.Styles[0].Fontsize != 80 || doc.Styles[0].MarginV != 80 {
+		t.Fatalf("template style was not rescaled from 720 to 1920: %+v", doc.Styles[0])
+	}
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+const (
+	// MaxPhraseLength is the widest phrase, in characters, that fits on one caption line
+	MaxPhraseLength = 24
+	// phrasePause is the silence between two words that always starts a new phrase
+	phrasePause = 0.35
+)
+
+// GroupWords splits words into phrases of at most maxWords words, breaking early
+// after punctuation, at pauses and before the phrase gets wider than MaxPhraseLength.
+// Empty words are left out
+func GroupWords(words []models.Word, maxWords int) [][]models.Word {
+	words = spokenWords(words)
+
+	var phrases [][]models.Word
+	var phrase []models.Word
+	length := 0
+
+	for i, word := range words {
+		if len(phrase) > 0 {
+			pause := word.Start - words[i-1].End
+			if len(phrase) >= maxWords || length+1+len(word.Word) > MaxPhraseLength || pause > phrasePause {
+				phrases = append(phrases, phrase)
+				phrase, length = nil, 0
+			}
+		}
+
+		if len(phrase) > 0 {
+			length++
+		}
+		phrase = append(phrase, word)
+		length += len(word.Word)
+
+		if endsPhrase(word.Word) {
+			phrases = append(phrases, phrase)
+			phrase, length = nil, 0
+		}
+	}
+
+	if len(phrase) > 0 {
+		phrases = append(phrases, phrase)
+	}
+
+	return phrases
+}
+
+// CreatePhraseDialog keeps each phrase of the segment on screen and emits one line per word
+// in which the spoken word is drawn with the highlight colour and scale of the style
+func CreatePhraseDialog(segment models.Segment, maxWords int, style SubtitleStyle) (string, error) {
+	events, err := phraseEvents(segment, maxWords, style)
+	if err != nil {
+		return "", err
+	}
+
+	return eventsToDialog(events), nil
+}
+
+func phraseEvents(segment models.Segment, maxWords int, style SubtitleStyle) ([]Event, error) {
+	var events []Event
+	phrases := GroupWords(segment.Words, maxWords)
+
+	for p, phrase := range phrases {
+		// the phrase stays up until the next one replaces it
+		phraseEnd := segment.End
+		if p < len(phrases)-1 {
+			phraseEnd = phrases[p+1][0].Start
+		}
+
+		for i, word := range phrase {
+			start := word.Start
+			if p == 0 && i == 0 {
+				start = segment.Start
+			}
+
+			end := phraseEnd
+			if i < len(phrase)-1 {
+				end = phrase[i+1].Start
+			}
+
+			if start > end {
+				return nil, errors.New("Start time is greater than end time")
+			}
+
+			if start < 0 {
+				start = 0
+			}
+
+			events = append(events, Event{Start: start, End: end, Style: "Default", Text: highlightWord(phrase, i, style)})
+		}
+	}
+
+	return events, nil
+}
+
+// highlightWord draws the active word with the highlight tags and resets the style after it
+func highlightWord(phrase []models.Word, active int, style SubtitleStyle) []TextPart {
+	words := func(from, to int) string {
+		texts := make([]string, 0, to-from)
+		for _, word := range phrase[from:to] {
+			texts = append(texts, word.Word)
+		}
+		return strings.Join(texts, " ")
+	}
+
+	var parts []TextPart
+	if active > 0 {
+		parts = append(parts, TextPart{Text: words(0, active) + " "})
+	}
+
+	tags := fmt.Sprintf("\\1c%s", assTagColor(style.HighlightColor))
+	if style.HighlightScale != 0 && style.HighlightScale != 100 {
+		tags += fmt.Sprintf("\\fscx%d\\fscy%d", style.HighlightScale, style.HighlightScale)
+	}
+	parts = append(parts, TextPart{Tags: tags, Text: phrase[active].Word})
+
+	if active < len(phrase)-1 {
+		parts = append(parts, TextPart{Tags: "\\r", Text: " " + words(active+1, len(phrase))})
+	}
+
+	return parts
+}
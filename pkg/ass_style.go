@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// referenceHeight is the frame height the sizes and margins of every SubtitleStyle are given for
+const referenceHeight = 1920
+
+// SubtitleStyle is the look of the captions, colours are #RRGGBB or #RRGGBBAA where AA is the opacity
+type SubtitleStyle struct {
+	Font         string
+	FontSize     int
+	PrimaryColor string
+	OutlineColor string
+	BackColor    string
+	Bold         bool
+	// BorderStyle is 1 for an outline around the letters and 3 for a box filled with OutlineColor
+	BorderStyle int
+	Outline     float64
+	Shadow      float64
+	// Alignment follows the numpad: 2 is bottom center, 5 is middle center
+	Alignment int
+	MarginV   int
+	// HighlightColor and HighlightScale (in percent) mark the spoken word of a phrase
+	HighlightColor string
+	HighlightScale int
+}
+
+// BundledFont is the family shipped in assets/fonts and handed to libass with fontsdir, the
+// presets use it so captions don't depend on the fonts installed on the server
+const BundledFont = "DejaVu Sans"
+
+// SubtitlePresets are the caption styles a job can pick by name
+var SubtitlePresets = map[string]SubtitleStyle{
+	// big bold words in the middle of the frame
+	"pop": {
+		Font:           BundledFont,
+		FontSize:       110,
+		PrimaryColor:   "#FFFFFF",
+		OutlineColor:   "#000000",
+		BackColor:      "#00000080",
+		Bold:           true,
+		BorderStyle:    1,
+		Outline:        6,
+		Shadow:         3,
+		Alignment:      5,
+		HighlightColor: "#FFE000",
+		HighlightScale: 115,
+	},
+	"bottom_third": {
+		Font:           BundledFont,
+		FontSize:       80,
+		PrimaryColor:   "#FFFFFF",
+		OutlineColor:   "#000000",
+		BackColor:      "#00000080",
+		Bold:           true,
+		BorderStyle:    1,
+		Outline:        4,
+		Shadow:         2,
+		Alignment:      2,
+		MarginV:        420,
+		HighlightColor: "#00E5FF",
+		HighlightScale: 100,
+	},
+	"outlined_yellow": {
+		Font:           BundledFont,
+		FontSize:       96,
+		PrimaryColor:   "#FFE000",
+		OutlineColor:   "#000000",
+		BackColor:      "#00000000",
+		Bold:           true,
+		BorderStyle:    1,
+		Outline:        7,
+		Alignment:      2,
+		MarginV:        600,
+		HighlightColor: "#FFFFFF",
+		HighlightScale: 110,
+	},
+	"boxed": {
+		Font:           BundledFont,
+		FontSize:       72,
+		PrimaryColor:   "#FFFFFF",
+		OutlineColor:   "#000000B3",
+		BackColor:      "#00000000",
+		BorderStyle:    3,
+		Outline:        14,
+		Alignment:      2,
+		MarginV:        500,
+		HighlightColor: "#FFE000",
+		HighlightScale: 100,
+	},
+}
+
+// DefaultSubtitleStyle is used when a job names a preset that doesn't exist anymore
+var DefaultSubtitleStyle = SubtitlePresets["pop"]
+
+// SubtitleStyleFor returns the named preset with the overrides applied
+func SubtitleStyleFor(name string, overrides *models.SubtitleOverrides) SubtitleStyle {
+	style, ok := SubtitlePresets[name]
+	if !ok {
+		style = DefaultSubtitleStyle
+	}
+
+	if overrides == nil {
+		return style
+	}
+
+	if overrides.Font != "" {
+		style.Font = overrides.Font
+	}
+	if overrides.FontSize != 0 {
+		style.FontSize = overrides.FontSize
+	}
+	if overrides.PrimaryColor != "" {
+		style.PrimaryColor = overrides.PrimaryColor
+	}
+	if overrides.OutlineColor != "" {
+		style.OutlineColor = overrides.OutlineColor
+	}
+	if overrides.BackColor != "" {
+		style.BackColor = overrides.BackColor
+	}
+	if overrides.Outline != nil {
+		style.Outline = *overrides.Outline
+	}
+	if overrides.MarginV != nil {
+		style.MarginV = *overrides.MarginV
+	}
+	if overrides.HighlightColor != "" {
+		style.HighlightColor = overrides.HighlightColor
+	}
+	if overrides.HighlightScale != 0 {
+		style.HighlightScale = overrides.HighlightScale
+	}
+
+	return style
+}
+
+// NewAssDocument returns a document without events whose Default style is style,
+// with PlayRes matching a video of width x height
+func NewAssDocument(style SubtitleStyle, width, height int) *AssDocument {
+	scale := float64(height) / referenceHeight
+	scaled := func(value float64) float64 {
+		return math.Round(value*scale*100) / 100
+	}
+
+	return &AssDocument{
+		Info: ScriptInfo{
+			ScriptType:            "v4.00+",
+			PlayResX:              width,
+			PlayResY:              height,
+			ScaledBorderAndShadow: true,
+			YCbCrMatrix:           "TV.709",
+		},
+		Styles: []Style{{
+			Name:            "Default",
+			Fontname:        style.Font,
+			Fontsize:        scaled(float64(style.FontSize)),
+			PrimaryColour:   assColor(style.PrimaryColor),
+			SecondaryColour: assColor(style.PrimaryColor),
+			OutlineColour:   assColor(style.OutlineColor),
+			BackColour:      assColor(style.BackColor),
+			Bold:            style.Bold,
+			ScaleX:          100,
+			ScaleY:          100,
+			BorderStyle:     style.BorderStyle,
+			Outline:         scaled(style.Outline),
+			Shadow:          scaled(style.Shadow),
+			Alignment:       style.Alignment,
+			MarginL:         int(scaled(60)),
+			MarginR:         int(scaled(60)),
+			MarginV:         int(scaled(float64(style.MarginV))),
+			Encoding:        1,
+		}},
+	}
+}
+
+// AssHeader writes the [Script Info] and [V4+ Styles] sections for a video of width x height,
+// followed by the format line of the [Events] section
+func AssHeader(style SubtitleStyle, width, height int) string {
+	return NewAssDocument(style, width, height).String()
+}
+
+// assColor turns #RRGGBB or #RRGGBBAA into the &HAABBGGRR notation of ASS, where alpha is the transparency
+func assColor(color string) string {
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 6 {
+		hex += "FF"
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return "&H00FFFFFF"
+	}
+
+	r, g, b, a := value>>24&0xFF, value>>16&0xFF, value>>8&0xFF, value&0xFF
+
+	return fmt.Sprintf("&H%02X%02X%02X%02X", 0xFF-a, b, g, r)
+}
+
+// assTagColor is the &HBBGGRR& notation used by override tags like \1c
+func assTagColor(color string) string {
+	return "&H" + assColor(color)[4:] + "&"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
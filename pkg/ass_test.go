@@ -1,7 +1,10 @@
 package pkg
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -57,3 +60,96 @@ func TestCreateDialogFromWords(t *testing.T) {
 		}
 	}
 }
+
+func TestAssHeaderMatchesResolution(t *testing.T) {
+	outline := 10.0
+	style := SubtitleStyleFor("outlined_yellow", &models.SubtitleOverrides{Font: "Impact", Outline: &outline})
+
+	header := AssHeader(style, 720, 1280)
+
+	for _, expected := range []string{
+		"PlayResX: 720\n",
+		"PlayResY: 1280\n",
+		// sizes are scaled from 1920 to 1280, yellow becomes BGR with an opaque alpha
+		"Style: Default,Impact,64,&H0000E0FF,&H0000E0FF,&H00000000,&HFF000000,-1,0,0,0,100,100,0,0,1,6.67,0,2,40,40,400,1\n",
+	} {
+		if !strings.Contains(header, expected) {
+			t.Fatalf("expected header to contain %q, got:\n%s", expected, header)
+		}
+	}
+}
+
+func TestCreatePhraseDialog(t *testing.T) {
+	segment := models.Segment{
+		Start: 0.0,
+		End:   4.0,
+		Words: []models.Word{
+			{Start: 0.0, End: 0.4, Word: "one"},
+			{Start: 0.5, End: 0.9, Word: "two"},
+			{Start: 1.0, End: 1.4, Word: "three,"},
+			{Start: 1.5, End: 1.9, Word: "four"},
+			{Start: 2.8, End: 3.2, Word: "five"},
+		},
+	}
+
+	phrases := GroupWords(segment.Words, 3)
+	if len(phrases) != 3 || len(phrases[0]) != 3 || len(phrases[1]) != 1 || len(phrases[2]) != 1 {
+		t.Fatalf("expected to break after the comma and at the pause, got %v", phrases)
+	}
+
+	dialog, err := CreatePhraseDialog(segment, 3, SubtitlePresets["pop"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := strings.Split(strings.TrimSpace(dialog), "\n")
+	if len(rows) != 5 {
+		t.Fatalf("expected a line per word, got %d", len(rows))
+	}
+
+	expected := fmt.Sprintf("Dialogue: 0,%s,%s,Default,,0000,0000,0000,,one {\\1c&H00E0FF&\\fscx115\\fscy115}two{\\r} three,", floatToAssTimeStamp(0.5), floatToAssTimeStamp(1.0))
+	if rows[1] != expected {
+		t.Fatalf("expected %s, got %s", expected, rows[1])
+	}
+
+	// the last word of a phrase stays up until the next phrase starts
+	if !strings.HasPrefix(rows[3], fmt.Sprintf("Dialogue: 0,%s,%s,", floatToAssTimeStamp(1.5), floatToAssTimeStamp(2.8))) {
+		t.Fatalf("unexpected timing: %s", rows[3])
+	}
+}
+
+func TestGroupWordsSkipsEmptyWords(t *testing.T) {
+	words := []models.Word{
+		{Start: 0.0, End: 0.4, Word: "one"},
+		{Start: 0.4, End: 0.5, Word: ""},
+		{Start: 0.5, End: 0.9, Word: "two."},
+		{Start: 1.0, End: 1.1, Word: "  "},
+	}
+
+	phrases := GroupWords(words, 3)
+	if len(phrases) != 1 || len(phrases[0]) != 2 || phrases[0][1].Word != "two." {
+		t.Fatalf("expected the empty words to be left out, got %v", phrases)
+	}
+
+	if _, err := CreatePhraseDialog(models.Segment{Start: 0, End: 1, Words: []models.Word{{Start: 0, End: 1, Word: ""}}}, 3, SubtitlePresets["pop"]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPresetsUseBundledFont(t *testing.T) {
+	for _, file := range []string{"DejaVuSans.ttf", "DejaVuSans-Bold.ttf"} {
+		data, err := os.ReadFile(filepath.Join("..", "assets", "fonts", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte(BundledFont)) {
+			t.Fatalf("expected %s to be the %s family", file, BundledFont)
+		}
+	}
+
+	for name, preset := range SubtitlePresets {
+		if preset.Font != BundledFont {
+			t.Errorf("preset %s uses %q, which isn't bundled", name, preset.Font)
+		}
+	}
+}
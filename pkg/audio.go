@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// AudioOptions controls the post-processing of the narration
+type AudioOptions struct {
+	// Loudness is the integrated loudness target in LUFS
+	Loudness float64
+	// TrimSilence cuts the silence at the start and end
+	TrimSilence bool
+	// Tempo speeds the speech up or down without changing its pitch, 1 leaves it alone
+	Tempo float64
+}
+
+const (
+	// maximum true peak in dBTP, leaves headroom for the AAC encoder
+	truePeak = -1.5
+	// loudness range in LU, speech rarely goes past it
+	loudnessRange = 11
+	// anything quieter than this counts as silence
+	silenceThreshold = "-50dB"
+)
+
+// loudnormReport is the JSON loudnorm prints with print_format=json, every value is a string
+type loudnormReport struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	OutputI      string `json:"output_i"`
+	OutputTP     string `json:"output_tp"`
+	OutputLRA    string `json:"output_lra"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// ProcessAudio trims, retimes and normalizes the narration to options.Loudness with a two pass
+// EBU R128 loudnorm, the result is a WAV in outputFolder
+func ProcessAudio(ctx context.Context, audioURL string, options AudioOptions, outputFolder string) (string, models.LoudnessStats, error) {
+	stats := models.LoudnessStats{Target: options.Loudness}
+
+	inputPath := filepath.Join(outputFolder, generateUniqueName()+audioExt(audioURL))
+	defer os.Remove(inputPath)
+
+	if err := DownloadFile(ctx, audioURL, inputPath); err != nil {
+		return "", stats, fmt.Errorf("failed to download audio %s: %v", audioURL, err)
+	}
+
+	// the first pass only measures, its output is thrown away
+	loudnorm := fmt.Sprintf("I=%.1f:TP=%.1f:LRA=%d:print_format=json", options.Loudness, truePeak, loudnessRange)
+	measured, err := runLoudnorm(ctx, cleanAudio(inputPath, options).Filter("loudnorm", ffmpeg.Args{loudnorm}), "-", ffmpeg.KwArgs{"f": "null"})
+	if err != nil {
+		return "", stats, fmt.Errorf("failed to measure loudness: %w", err)
+	}
+
+	inputI, _ := strconv.ParseFloat(measured.InputI, 64)
+	if math.IsInf(inputI, 0) || math.IsNaN(inputI) {
+		return "", stats, errors.New("the narration is silent")
+	}
+
+	// feeding the measurements back lets loudnorm apply a single linear gain instead of compressing
+	loudnorm += fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+
+	outputPath := filepath.Join(outputFolder, generateUniqueName()+".wav")
+	normalized, err := runLoudnorm(ctx, cleanAudio(inputPath, options).Filter("loudnorm", ffmpeg.Args{loudnorm}), outputPath, ffmpeg.KwArgs{"c:a": "pcm_s16le", "ar": 48000})
+	if err != nil {
+		removeOnCancel(ctx, outputPath)
+		return "", stats, fmt.Errorf("failed to normalize audio: %w", err)
+	}
+
+	stats.InputIntegrated = inputI
+	stats.InputTruePeak = parseLoudness(measured.InputTP)
+	stats.InputRange = parseLoudness(measured.InputLRA)
+	stats.OutputIntegrated = parseLoudness(normalized.OutputI)
+	stats.OutputTruePeak = parseLoudness(normalized.OutputTP)
+	stats.OutputRange = parseLoudness(normalized.OutputLRA)
+
+	return outputPath, stats, nil
+}
+
+// cleanAudio trims the silence at both ends and changes the tempo of the input
+func cleanAudio(inputPath string, options AudioOptions) *ffmpeg.Stream {
+	stream := ffmpeg.Input(inputPath).Audio()
+
+	if options.TrimSilence {
+		// silenceremove only trims the start reliably, so the end is trimmed on the reversed audio
+		trim := fmt.Sprintf("start_periods=1:start_silence=0.05:start_threshold=%s", silenceThreshold)
+		stream = stream.
+			Filter("silenceremove", ffmpeg.Args{trim}).
+			Filter("areverse", nil).
+			Filter("silenceremove", ffmpeg.Args{trim}).
+			Filter("areverse", nil)
+	}
+
+	if options.Tempo > 0 && options.Tempo != 1 {
+		stream = stream.Filter("atempo", ffmpeg.Args{fmt.Sprintf("%.3f", options.Tempo)})
+	}
+
+	return stream
+}
+
+// runLoudnorm runs ffmpeg and parses the report loudnorm prints on stderr
+func runLoudnorm(ctx context.Context, stream *ffmpeg.Stream, output string, kwargs ffmpeg.KwArgs) (loudnormReport, error) {
+	var report loudnormReport
+	var stderr bytes.Buffer
+
+	err := ffmpeg.OutputContext(ctx, []*ffmpeg.Stream{stream}, output, kwargs).
+		WithOutput(bytes.NewBuffer(nil), &stderr).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		return report, fmt.Errorf("%v: %s", err, lastLine(stderr.String()))
+	}
+
+	return parseLoudnormReport(stderr.String())
+}
+
+// parseLoudnormReport finds the JSON block loudnorm prints after the rest of the ffmpeg log
+func parseLoudnormReport(log string) (loudnormReport, error) {
+	var report loudnormReport
+
+	key := strings.LastIndex(log, `"input_i"`)
+	if key < 0 {
+		return report, errors.New("ffmpeg printed no loudnorm report")
+	}
+	start := strings.LastIndex(log[:key], "{")
+	end := strings.Index(log[key:], "}")
+	if start < 0 || end < 0 {
+		return report, errors.New("ffmpeg printed an incomplete loudnorm report")
+	}
+
+	if err := json.Unmarshal([]byte(log[start:key+end+1]), &report); err != nil {
+		return report, fmt.Errorf("invalid loudnorm report: %w", err)
+	}
+	return report, nil
+}
+
+// parseLoudness reads a loudnorm value, -inf on silence is reported as 0 since JSON has no infinity
+func parseLoudness(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0
+	}
+	return f
+}
+
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return lines[len(lines)-1]
+}
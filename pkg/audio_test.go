@@ -0,0 +1,39 @@
+package pkg
+
+import "testing"
+
+func TestParseLoudnormReport(t *testing.T) {
+	log := `Stream mapping:
+  Stream #0:0 (pcm_s16le) -> loudnorm:default
+size=N/A time=00:00:05.00 bitrate=N/A speed= 512x
+[Parsed_loudnorm_4 @ 0x5581b2c0] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-14.02",
+	"output_tp" : "-1.50",
+	"output_lra" : "11.00",
+	"output_thresh" : "-25.41",
+	"normalization_type" : "linear",
+	"target_offset" : "0.02"
+}
+`
+
+	report, err := parseLoudnormReport(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.InputI != "-27.61" || report.TargetOffset != "0.02" || parseLoudness(report.OutputI) != -14.02 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if _, err := parseLoudnormReport("size=N/A time=00:00:05.00"); err == nil {
+		t.Fatal("expected an error without a report")
+	}
+
+	if parseLoudness("-inf") != 0 {
+		t.Fatal("expected -inf to be reported as 0")
+	}
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// MaxCueLength is the longest caption line, in characters, before a phrase is split
+const MaxCueLength = 42
+
+// SubtitleContentTypes are the MIME types of the sidecar caption formats
+var SubtitleContentTypes = map[string]string{
+	"srt": "application/x-subrip",
+	"vtt": "text/vtt",
+}
+
+// Cue is one caption shown on screen between Start and End
+type Cue struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// PhraseCues splits every segment into phrases that end at punctuation or at MaxCueLength characters
+func PhraseCues(transcription models.TranscriptionOutput) []Cue {
+	var cues []Cue
+
+	for _, segment := range transcription.Segments {
+		words := spokenWords(segment.Words)
+		if len(words) == 0 {
+			if text := strings.TrimSpace(segment.Text); text != "" {
+				cues = append(cues, Cue{Start: segment.Start, End: segment.End, Text: text})
+			}
+			continue
+		}
+
+		var cue Cue
+		for i, word := range words {
+			if cue.Text != "" && len(cue.Text)+1+len(word.Word) > MaxCueLength {
+				cues = append(cues, cue)
+				cue = Cue{}
+			}
+
+			if cue.Text == "" {
+				cue.Start = word.Start
+				cue.Text = word.Word
+			} else {
+				cue.Text += " " + word.Word
+			}
+			cue.End = word.End
+
+			if endsPhrase(word.Word) || i == len(words)-1 {
+				cues = append(cues, cue)
+				cue = Cue{}
+			}
+		}
+	}
+
+	// keep each cue on screen until the next one starts so captions don't flicker
+	for i := 0; i < len(cues)-1; i++ {
+		if gap := cues[i+1].Start - cues[i].End; gap > 0 && gap < 1 {
+			cues[i].End = cues[i+1].Start
+		}
+	}
+
+	return cues
+}
+
+// spokenWords drops the empty words transcribers sometimes return between the real ones
+func spokenWords(words []models.Word) []models.Word {
+	var spoken []models.Word
+	for _, word := range words {
+		if strings.TrimSpace(word.Word) != "" {
+			spoken = append(spoken, word)
+		}
+	}
+	return spoken
+}
+
+// endsPhrase reports whether the word closes a phrase with punctuation
+func endsPhrase(word string) bool {
+	return strings.ContainsAny(lastRune(word), ".,;:!?")
+}
+
+// CreateSrtFile writes the transcription as SubRip captions
+func CreateSrtFile(fileName string, transcription models.TranscriptionOutput) error {
+	var srt strings.Builder
+
+	for i, cue := range PhraseCues(transcription) {
+		fmt.Fprintf(&srt, "%d\n%s --> %s\n%s\n\n", i+1, floatToCueTimeStamp(cue.Start, ","), floatToCueTimeStamp(cue.End, ","), cue.Text)
+	}
+
+	return os.WriteFile(fileName, []byte(srt.String()), 0o644)
+}
+
+// vttEscaper escapes the characters WebVTT reads as markup in cue text
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// CreateVttFile writes the transcription as WebVTT captions
+func CreateVttFile(fileName string, transcription models.TranscriptionOutput) error {
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n\n")
+
+	for _, cue := range PhraseCues(transcription) {
+		fmt.Fprintf(&vtt, "%s --> %s\n%s\n\n", floatToCueTimeStamp(cue.Start, "."), floatToCueTimeStamp(cue.End, "."), vttEscaper.Replace(cue.Text))
+	}
+
+	return os.WriteFile(fileName, []byte(vtt.String()), 0o644)
+}
+
+// floatToCueTimeStamp formats seconds as hh:mm:ss followed by the separator and milliseconds
+func floatToCueTimeStamp(time float64, separator string) string {
+	if time < 0 {
+		time = 0
+	}
+
+	millis := int(time*1000 + 0.5)
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", millis/3600000, millis/60000%60, millis/1000%60, separator, millis%1000)
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+func TestCreateSrtAndVttFiles(t *testing.T) {
+	transcription := models.TranscriptionOutput{
+		Segments: []models.Segment{
+			{
+				Start: 0.0,
+				End:   2.5,
+				Words: []models.Word{
+					{Start: 0.0, End: 0.5, Word: "Hello,"},
+					{Start: 0.6, End: 1.2, Word: "little"},
+					{Start: 1.3, End: 2.5, Word: "robot."},
+				},
+			},
+			{
+				Start: 3725.0,
+				End:   3726.25,
+				Words: []models.Word{
+					{Start: 3725.0, End: 3726.25, Word: "Goodbye!"},
+				},
+			},
+		},
+	}
+
+	dir := t.TempDir()
+
+	srtPath := filepath.Join(dir, "subtitles.srt")
+	if err := CreateSrtFile(srtPath, transcription); err != nil {
+		t.Fatal(err)
+	}
+
+	srt, _ := os.ReadFile(srtPath)
+	expectedSrt := "1\n00:00:00,000 --> 00:00:00,600\nHello,\n\n" +
+		"2\n00:00:00,600 --> 00:00:02,500\nlittle robot.\n\n" +
+		"3\n01:02:05,000 --> 01:02:06,250\nGoodbye!\n\n"
+	if string(srt) != expectedSrt {
+		t.Fatalf("unexpected srt:\n%s", srt)
+	}
+
+	vttPath := filepath.Join(dir, "subtitles.vtt")
+	if err := CreateVttFile(vttPath, transcription); err != nil {
+		t.Fatal(err)
+	}
+
+	vtt, _ := os.ReadFile(vttPath)
+	expectedVtt := "WEBVTT\n\n" +
+		"00:00:00.000 --> 00:00:00.600\nHello,\n\n" +
+		"00:00:00.600 --> 00:00:02.500\nlittle robot.\n\n" +
+		"01:02:05.000 --> 01:02:06.250\nGoodbye!\n\n"
+	if string(vtt) != expectedVtt {
+		t.Fatalf("unexpected vtt:\n%s", vtt)
+	}
+}
+
+func TestCreateVttFileEscapesMarkup(t *testing.T) {
+	transcription := models.TranscriptionOutput{
+		Segments: []models.Segment{
+			{
+				Start: 0.0,
+				End:   2.0,
+				Words: []models.Word{
+					{Start: 0.0, End: 0.5, Word: "Tom"},
+					{Start: 0.5, End: 1.0, Word: "&"},
+					{Start: 1.0, End: 2.0, Word: "<b>Jerry</b>"},
+				},
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "subtitles.vtt")
+	if err := CreateVttFile(path, transcription); err != nil {
+		t.Fatal(err)
+	}
+
+	vtt, _ := os.ReadFile(path)
+	expected := "WEBVTT\n\n00:00:00.000 --> 00:00:02.000\nTom &amp; &lt;b&gt;Jerry&lt;/b&gt;\n\n"
+	if string(vtt) != expected {
+		t.Fatalf("unexpected vtt:\n%s", vtt)
+	}
+}
+
+func TestPhraseCuesSkipEmptyWords(t *testing.T) {
+	transcription := models.TranscriptionOutput{
+		Segments: []models.Segment{
+			{
+				Start: 0.0,
+				End:   2.0,
+				Words: []models.Word{
+					{Start: 0.0, End: 0.5, Word: "Hello,"},
+					{Start: 0.5, End: 0.6, Word: ""},
+					{Start: 0.6, End: 1.2, Word: " "},
+					{Start: 1.3, End: 2.0, Word: "robot"},
+				},
+			},
+			{Start: 2.0, End: 3.0, Text: "...", Words: []models.Word{{Start: 2.0, End: 3.0, Word: ""}}},
+		},
+	}
+
+	cues := PhraseCues(transcription)
+	if len(cues) != 3 || cues[0].Text != "Hello," || cues[1].Text != "robot" || cues[2].Text != "..." {
+		t.Fatalf("expected the empty words to be skipped, got %+v", cues)
+	}
+}
@@ -0,0 +1,205 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// FontMetrics holds the horizontal metrics of a TrueType font, enough to estimate how wide
+// libass draws a line of text
+type FontMetrics struct {
+	unitsPerEm uint16
+	ascender   int16
+	descender  int16
+	advances   []uint16
+	glyphs     map[rune]uint16
+}
+
+// LoadFont reads the metrics of the TTF file at path
+func LoadFont(path string) (*FontMetrics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	font, err := ParseFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", path, err)
+	}
+
+	return font, nil
+}
+
+// ParseFont reads the head, hhea, hmtx and cmap tables of a TrueType font
+func ParseFont(data []byte) (*FontMetrics, error) {
+	if len(data) < 12 {
+		return nil, errors.New("font is too short")
+	}
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+
+	for i := 0; i < numTables; i++ {
+		record := 12 + 16*i
+		if record+16 > len(data) {
+			return nil, errors.New("truncated table directory")
+		}
+
+		tag := string(data[record : record+4])
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("table %s is out of bounds", tag)
+		}
+
+		tables[tag] = data[offset : offset+length]
+	}
+
+	head, hhea, hmtx, cmap := tables["head"], tables["hhea"], tables["hmtx"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || hmtx == nil || cmap == nil {
+		return nil, errors.New("missing head, hhea, hmtx or cmap table")
+	}
+
+	font := &FontMetrics{
+		unitsPerEm: binary.BigEndian.Uint16(head[18:]),
+		ascender:   int16(binary.BigEndian.Uint16(hhea[4:])),
+		descender:  int16(binary.BigEndian.Uint16(hhea[6:])),
+	}
+
+	numberOfHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numberOfHMetrics == 0 || len(hmtx) < numberOfHMetrics*4 {
+		return nil, errors.New("truncated hmtx table")
+	}
+
+	font.advances = make([]uint16, numberOfHMetrics)
+	for i := range font.advances {
+		font.advances[i] = binary.BigEndian.Uint16(hmtx[i*4:])
+	}
+
+	glyphs, err := parseCmap(cmap)
+	if err != nil {
+		return nil, err
+	}
+	font.glyphs = glyphs
+
+	return font, nil
+}
+
+// parseCmap reads the unicode BMP subtable (format 4)
+func parseCmap(cmap []byte) (map[rune]uint16, error) {
+	if len(cmap) < 4 {
+		return nil, errors.New("truncated cmap table")
+	}
+
+	numSubtables := int(binary.BigEndian.Uint16(cmap[2:]))
+
+	for i := 0; i < numSubtables; i++ {
+		record := 4 + 8*i
+		if record+8 > len(cmap) {
+			break
+		}
+
+		platform := binary.BigEndian.Uint16(cmap[record:])
+		encoding := binary.BigEndian.Uint16(cmap[record+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[record+4:]))
+
+		unicode := platform == 0 || (platform == 3 && encoding == 1)
+		if !unicode || offset+4 > len(cmap) || binary.BigEndian.Uint16(cmap[offset:]) != 4 {
+			continue
+		}
+
+		return parseCmapFormat4(cmap[offset:])
+	}
+
+	return nil, errors.New("font has no unicode cmap")
+}
+
+func parseCmapFormat4(table []byte) (map[rune]uint16, error) {
+	if len(table) < 14 {
+		return nil, errors.New("truncated cmap subtable")
+	}
+
+	segments := int(binary.BigEndian.Uint16(table[6:])) / 2
+	endCodes := 14
+	startCodes := endCodes + segments*2 + 2
+	deltas := startCodes + segments*2
+	rangeOffsets := deltas + segments*2
+
+	if rangeOffsets+segments*2 > len(table) {
+		return nil, errors.New("truncated cmap subtable")
+	}
+
+	glyphs := make(map[rune]uint16)
+
+	for s := 0; s < segments; s++ {
+		end := binary.BigEndian.Uint16(table[endCodes+s*2:])
+		start := binary.BigEndian.Uint16(table[startCodes+s*2:])
+		delta := binary.BigEndian.Uint16(table[deltas+s*2:])
+		rangeOffset := int(binary.BigEndian.Uint16(table[rangeOffsets+s*2:]))
+
+		for c := uint32(start); c <= uint32(end) && c != 0xFFFF; c++ {
+			var glyph uint16
+
+			if rangeOffset == 0 {
+				glyph = uint16(c) + delta
+			} else {
+				// the offset is relative to the position of the range offset itself
+				index := rangeOffsets + s*2 + rangeOffset + int(c-uint32(start))*2
+				if index+2 > len(table) {
+					continue
+				}
+				glyph = binary.BigEndian.Uint16(table[index:])
+				if glyph != 0 {
+					glyph += delta
+				}
+			}
+
+			if glyph != 0 {
+				glyphs[rune(c)] = glyph
+			}
+		}
+	}
+
+	return glyphs, nil
+}
+
+// TextWidth estimates the width of text drawn at the ASS font size, libass scales fonts so that
+// the distance between ascender and descender equals the font size
+func (f *FontMetrics) TextWidth(text string, size float64) float64 {
+	units := 0.0
+
+	for _, r := range text {
+		units += float64(f.advance(r))
+	}
+
+	height := float64(f.ascender) - float64(f.descender)
+	if height <= 0 {
+		height = float64(f.unitsPerEm)
+	}
+
+	return units * size / height
+}
+
+func (f *FontMetrics) advance(r rune) uint16 {
+	glyph, ok := f.glyphs[r]
+	if !ok {
+		// unknown characters are drawn from a fallback font, CJK ones are full width and
+		// anything else is assumed to be of average width
+		if isCJK(r) {
+			return f.unitsPerEm
+		}
+		glyph, ok = f.glyphs['n']
+		if !ok {
+			return f.unitsPerEm / 2
+		}
+	}
+
+	if int(glyph) >= len(f.advances) {
+		// glyphs past numberOfHMetrics share the last advance
+		return f.advances[len(f.advances)-1]
+	}
+
+	return f.advances[glyph]
+}
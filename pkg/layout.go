@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// DefaultSafeArea keeps captions clear of the TikTok, Reels and Shorts overlays: the caption
+// and music info at the bottom and the like/comment/share buttons on the right
+var DefaultSafeArea = models.SafeArea{Top: 250, Bottom: 480, Left: 60, Right: 180}
+
+const (
+	// DefaultMaxLines is how many lines a caption may wrap into before its font shrinks
+	DefaultMaxLines = 2
+	// minFontScale is the smallest a caption is shrunk to, past it the text is allowed to overflow
+	minFontScale = 0.5
+)
+
+var scaleTag = regexp.MustCompile(`\\fscx(\d+(?:\.\d+)?)`)
+
+// CaptionLayout wraps and shrinks captions so they fit inside the safe area,
+// sizes of the safe area are given for a 1920 pixels tall video
+type CaptionLayout struct {
+	Regular  *FontMetrics
+	Bold     *FontMetrics
+	SafeArea models.SafeArea
+	MaxLines int
+}
+
+// LoadCaptionLayout reads the regular and bold BundledFont metrics from fontsDir
+func LoadCaptionLayout(fontsDir string, safeArea models.SafeArea) (*CaptionLayout, error) {
+	regular, err := LoadFont(filepath.Join(fontsDir, "DejaVuSans.ttf"))
+	if err != nil {
+		return nil, err
+	}
+
+	bold, err := LoadFont(filepath.Join(fontsDir, "DejaVuSans-Bold.ttf"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CaptionLayout{Regular: regular, Bold: bold, SafeArea: safeArea, MaxLines: DefaultMaxLines}, nil
+}
+
+// Apply moves the style margins inside the safe area, then breaks every event that is
+// wider than the space left with \N and shrinks the ones that still don't fit
+func (l CaptionLayout) Apply(doc *AssDocument) {
+	scale := float64(doc.Info.PlayResY) / referenceHeight
+
+	for i := range doc.Styles {
+		style := &doc.Styles[i]
+		style.MarginL = max(style.MarginL, int(float64(l.SafeArea.Left)*scale))
+		style.MarginR = max(style.MarginR, int(float64(l.SafeArea.Right)*scale))
+
+		switch style.Alignment {
+		case 1, 2, 3:
+			style.MarginV = max(style.MarginV, int(float64(l.SafeArea.Bottom)*scale))
+		case 7, 8, 9:
+			style.MarginV = max(style.MarginV, int(float64(l.SafeArea.Top)*scale))
+		}
+	}
+
+	// we place every line break ourselves
+	doc.Info.WrapStyle = 2
+
+	for i := range doc.Events {
+		event := &doc.Events[i]
+		if event.Comment {
+			continue
+		}
+
+		style := doc.style(event.Style)
+		if style == nil {
+			continue
+		}
+
+		l.layoutEvent(event, *style, float64(doc.Info.PlayResX-style.MarginL-style.MarginR))
+	}
+}
+
+func (l CaptionLayout) layoutEvent(event *Event, style Style, available float64) {
+	font := l.Regular
+	if style.Bold {
+		font = l.Bold
+	}
+
+	maxLines := l.MaxLines
+	if maxLines < 1 {
+		maxLines = DefaultMaxLines
+	}
+
+	width := func(text string, factor float64) float64 {
+		size := style.Fontsize * factor
+		return (font.TextWidth(text, size) + style.Spacing*float64(len([]rune(text)))) * style.ScaleX / 100
+	}
+
+	// leave room for the highlighted word growing
+	growth := 0.0
+	for _, part := range event.Text {
+		if match := scaleTag.FindStringSubmatch(part.Tags); match != nil {
+			if scale, err := strconv.ParseFloat(match[1], 64); err == nil && scale > 100 {
+				growth = max(growth, width(part.Text, 1)*(scale-100)/100)
+			}
+		}
+	}
+
+	plain := event.Plain()
+	words, starts, glued := splitWords(plain)
+	if len(words) == 0 {
+		return
+	}
+
+	factor := 1.0
+	var breaks []int
+
+	for {
+		var fits bool
+		breaks, fits = wrapWords(words, glued, maxLines, func(line string) bool {
+			return width(line, factor)+growth*factor <= available
+		})
+		if fits || factor <= minFontScale {
+			break
+		}
+		factor = max(factor-0.05, minFontScale)
+	}
+
+	breakAt := make(map[int]bool)
+	insertAt := make(map[int]bool)
+	for _, word := range breaks {
+		if glued[word] {
+			insertAt[starts[word]] = true
+		} else {
+			// replace the space before the word
+			breakAt[starts[word]-1] = true
+		}
+	}
+
+	offset := 0
+	for p := range event.Text {
+		text := []byte(event.Text[p].Text)
+		var wrapped []byte
+		for i, b := range text {
+			if insertAt[offset+i] {
+				wrapped = append(wrapped, '\n')
+			}
+			if breakAt[offset+i] {
+				b = '\n'
+			}
+			wrapped = append(wrapped, b)
+		}
+		offset += len(text)
+		event.Text[p].Text = string(wrapped)
+
+		if factor < 1 {
+			event.Text[p].Tags += fmt.Sprintf(`\fs%s`, formatFloat(float64(int(style.Fontsize*factor))))
+		}
+	}
+}
+
+// wrapWords greedily fills lines, it returns the index of every word that starts a new line
+// and whether the words fit in maxLines lines that all satisfy fits
+func wrapWords(words []string, glued []bool, maxLines int, fits func(string) bool) ([]int, bool) {
+	var breaks []int
+	line := words[0]
+	ok := fits(line)
+
+	for i := 1; i < len(words); i++ {
+		separator := " "
+		if glued[i] {
+			separator = ""
+		}
+
+		if candidate := line + separator + words[i]; fits(candidate) {
+			line = candidate
+			continue
+		}
+
+		breaks = append(breaks, i)
+		line = words[i]
+		ok = ok && fits(line)
+	}
+
+	return breaks, ok && len(breaks) < maxLines
+}
+
+// splitWords splits text on single spaces and returns the byte offset where each word starts.
+// Chinese and Japanese have no spaces so every one of their characters is a word too, glued
+// reports the words that aren't preceded by a space and can be broken before without one
+func splitWords(text string) (words []string, starts []int, glued []bool) {
+	start := 0
+	cjk, joined := false, false
+
+	for i, r := range text + " " {
+		if r == ' ' {
+			if i > start {
+				words, starts, glued = append(words, text[start:i]), append(starts, start), append(glued, joined)
+			}
+			start, cjk, joined = i+1, false, false
+			continue
+		}
+
+		// punctuation stays with the character before it so lines never start with it
+		if i > start && normalizeWord(text[start:i]) != "" && (isCJK(r) || (cjk && normalizeWord(string(r)) != "")) {
+			words, starts, glued = append(words, text[start:i]), append(starts, start), append(glued, joined)
+			start, joined = i, true
+		}
+		if normalizeWord(string(r)) != "" {
+			cjk = isCJK(r)
+		}
+	}
+
+	return words, starts, glued
+}
+
+func (d *AssDocument) style(name string) *Style {
+	for i := range d.Styles {
+		if d.Styles[i].Name == name {
+			return &d.Styles[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptionLayoutWrapsAndShrinks(t *testing.T) {
+	layout, err := LoadCaptionLayout(filepath.Join("..", "assets", "fonts"), DefaultSafeArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if layout.Bold.TextWidth("W", 100) <= layout.Bold.TextWidth("i", 100) {
+		t.Fatal("expected W to be wider than i")
+	}
+
+	doc := NewAssDocument(SubtitlePresets["bottom_third"], 720, 1280)
+	doc.Events = []Event{
+		{End: 1, Style: "Default", Text: []TextPart{{Text: "a short line"}}},
+		{End: 1, Style: "Default", Text: []TextPart{{Text: "this caption is much too long to fit on a single line"}}},
+		{End: 1, Style: "Default", Text: []TextPart{{Text: "Pneumonoultramicroscopicsilicovolcanoconiosis"}}},
+		{End: 1, Style: "Default", Text: []TextPart{{Text: "今天我们一起去公园散步，"}, {Text: "天气非常好。"}}},
+	}
+
+	layout.Apply(doc)
+
+	style := doc.Styles[0]
+	if style.MarginR != 120 || style.MarginV != 320 {
+		t.Fatalf("expected the margins to be moved inside the safe area, got %+v", style)
+	}
+
+	if strings.Contains(doc.Events[0].Plain(), "\n") || doc.Events[0].Text[0].Tags != "" {
+		t.Fatalf("short line should be left alone: %+v", doc.Events[0])
+	}
+
+	if lines := strings.Count(doc.Events[1].Plain(), "\n") + 1; lines != 2 {
+		t.Fatalf("expected the long caption to wrap into 2 lines, got %q", doc.Events[1].Plain())
+	}
+
+	if !strings.Contains(doc.Events[2].Text[0].Tags, `\fs`) {
+		t.Fatalf("expected the long word to be shrunk: %+v", doc.Events[2])
+	}
+
+	cjk := doc.Events[3].Plain()
+	if !strings.Contains(cjk, "\n") || strings.Contains(cjk, "\n。") || strings.Contains(cjk, "\n，") {
+		t.Fatalf("expected the CJK caption to wrap between characters, got %q", cjk)
+	}
+	if strings.ReplaceAll(cjk, "\n", "") != "今天我们一起去公园散步，天气非常好。" {
+		t.Fatalf("expected wrapping to only insert line breaks, got %q", cjk)
+	}
+
+	if !strings.Contains(doc.String(), "WrapStyle: 2\n") {
+		t.Fatal("expected automatic wrapping to be turned off")
+	}
+}
@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// minSceneDuration is the shortest a scene may be in seconds, shorter images flash by
+const minSceneDuration = 2.0
+
+// words that say nothing about what a sentence is about
+var stopWords = map[string]bool{
+	"about": true, "after": true, "again": true, "also": true, "been": true, "before": true, "being": true,
+	"could": true, "does": true, "down": true, "each": true, "even": true, "every": true, "from": true,
+	"have": true, "here": true, "into": true, "just": true, "like": true, "more": true, "most": true,
+	"much": true, "never": true, "only": true, "other": true, "over": true, "said": true, "same": true,
+	"should": true, "some": true, "such": true, "than": true, "that": true, "their": true, "them": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true, "those": true, "through": true,
+	"until": true, "very": true, "were": true, "what": true, "when": true, "where": true, "which": true,
+	"while": true, "will": true, "with": true, "would": true, "your": true,
+}
+
+// PlanScenes splits the narration into at most maxScenes scenes that change when the story does.
+// Cuts go where a sentence ends and the next ones talk about something else or follow a pause,
+// the boundaries of the story scenes of a structured script come first. No scene is shorter than
+// minSceneDuration so short narrations get fewer scenes, together they cover the whole narration
+// and those taken from the story keep their visual
+func PlanScenes(transcript models.TranscriptionOutput, maxScenes int, story []models.Scene) []models.Scene {
+	var words []models.Word
+	for _, segment := range transcript.Segments {
+		words = append(words, segment.Words...)
+	}
+	if len(words) == 0 || maxScenes < 1 {
+		return nil
+	}
+
+	total := transcript.Segments[len(transcript.Segments)-1].End
+
+	storyStarts := storyWordStarts(story, len(words))
+	sentences := sentenceEnds(words)
+
+	// every gap between words is a candidate, the best ones that keep scenes long enough win
+	type candidate struct {
+		index int
+		score float64
+	}
+	var candidates []candidate
+	for i := 1; i < len(words); i++ {
+		pause := min(words[i].Start-words[i-1].End, 1) / 2
+
+		var score float64
+		switch {
+		case storyStarts[i] >= 0:
+			score = 3 + pause
+		case sentences[i-1]:
+			score = 1 - topicSimilarity(words, sentences, i) + pause
+		case strings.ContainsAny(lastRune(words[i-1].Word), ",;:"):
+			score = -1 + pause
+		default:
+			score = -2 + pause
+		}
+		candidates = append(candidates, candidate{i, score})
+	}
+	sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].score > candidates[b].score })
+
+	cuts := []float64{0, total}
+	starts := []int{0}
+	for _, c := range candidates {
+		if len(starts) == maxScenes {
+			break
+		}
+
+		at := words[c.index].Start
+		position := sort.SearchFloat64s(cuts, at)
+		if position == 0 || position == len(cuts) || at-cuts[position-1] < minSceneDuration || cuts[position]-at < minSceneDuration {
+			continue
+		}
+
+		cuts = append(cuts[:position], append([]float64{at}, cuts[position:]...)...)
+		starts = append(starts, c.index)
+	}
+	sort.Ints(starts)
+
+	scenes := make([]models.Scene, len(starts))
+	for i, start := range starts {
+		end := len(words)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		var text []string
+		for _, word := range words[start:end] {
+			text = append(text, strings.TrimSpace(word.Word))
+		}
+
+		scenes[i] = models.Scene{Text: strings.Join(text, " "), Start: cuts[i], End: cuts[i+1]}
+		if visual := storyVisual(story, storyStarts, start); visual != "" {
+			scenes[i].Visual = visual
+		}
+	}
+
+	return scenes
+}
+
+// storyWordStarts maps the word index where each story scene starts to the scene, -1 elsewhere.
+// The story scenes split the script, so their word counts are spread over the spoken words
+func storyWordStarts(story []models.Scene, numWords int) []int {
+	starts := make([]int, numWords)
+	for i := range starts {
+		starts[i] = -1
+	}
+
+	storyWords := 0
+	for _, scene := range story {
+		storyWords += len(strings.Fields(scene.Text))
+	}
+	if storyWords == 0 {
+		return starts
+	}
+
+	covered := 0
+	for i, scene := range story {
+		index := covered * numWords / storyWords
+		if index < numWords {
+			starts[index] = i
+		}
+		covered += len(strings.Fields(scene.Text))
+	}
+
+	return starts
+}
+
+// storyVisual is the visual of the story scene being read at word index
+func storyVisual(story []models.Scene, storyStarts []int, index int) string {
+	for i := index; i >= 0; i-- {
+		if storyStarts[i] >= 0 {
+			return story[storyStarts[i]].Visual
+		}
+	}
+	return ""
+}
+
+// sentenceEnds marks the words that close a sentence
+func sentenceEnds(words []models.Word) []bool {
+	ends := make([]bool, len(words))
+	for i, word := range words {
+		ends[i] = strings.ContainsAny(lastRune(word.Word), ".!?…")
+	}
+	return ends
+}
+
+// topicSimilarity compares the content words of the two sentences before the word at index with
+// the two after it, 1 when they share every word and 0 when they share none
+func topicSimilarity(words []models.Word, sentences []bool, index int) float64 {
+	before := contentWords(words, sentences, index-1, -1)
+	after := contentWords(words, sentences, index, 1)
+	if len(before) == 0 || len(after) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range before {
+		if after[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(before)+len(after)-shared)
+}
+
+// contentWords collects the meaningful words of up to two sentences walking from index in direction
+func contentWords(words []models.Word, sentences []bool, index, direction int) map[string]bool {
+	found := make(map[string]bool)
+	sentencesSeen := 0
+
+	for i := index; i >= 0 && i < len(words); i += direction {
+		// walking backwards the sentence before starts after the previous end
+		if direction < 0 && i != index && sentences[i] {
+			sentencesSeen++
+		}
+		if sentencesSeen == 2 {
+			break
+		}
+
+		word := strings.ToLower(strings.TrimFunc(words[i].Word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }))
+		word = strings.TrimSuffix(strings.TrimSuffix(word, "'s"), "s")
+		if len([]rune(word)) > 3 && !stopWords[word] {
+			found[word] = true
+		}
+
+		if direction > 0 && sentences[i] {
+			sentencesSeen++
+			if sentencesSeen == 2 {
+				break
+			}
+		}
+	}
+
+	return found
+}
+
+// lastRune is the last character of a word ignoring closing quotes and brackets
+func lastRune(word string) string {
+	word = strings.TrimRight(strings.TrimSpace(word), `"')]”’»`)
+	runes := []rune(word)
+	if len(runes) == 0 {
+		return ""
+	}
+	return string(runes[len(runes)-1])
+}
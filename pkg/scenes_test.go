@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// spokenTranscript reads every word for 0.4 seconds with a pause after each sentence
+func spokenTranscript(sentences ...string) models.TranscriptionOutput {
+	var segment models.Segment
+	at := 0.0
+	for _, sentence := range sentences {
+		for _, word := range strings.Fields(sentence) {
+			segment.Words = append(segment.Words, models.Word{Word: word, Start: at, End: at + 0.4})
+			at += 0.4
+		}
+		at += 0.2
+	}
+	segment.End = at
+	return models.TranscriptionOutput{Segments: []models.Segment{segment}}
+}
+
+func TestPlanScenesCutsAtTopicShifts(t *testing.T) {
+	transcript := spokenTranscript(
+		"The old lighthouse keeper climbed the stairs.",
+		"The lighthouse lamp had been dark for years.",
+		"The keeper polished the lamp until it shone.",
+		"Far away, a fishing boat was lost at sea.",
+		"The fishing crew could not see the rocks.",
+		"Waves pushed the boat toward the cliffs.",
+	)
+
+	scenes := PlanScenes(transcript, 2, nil)
+	if len(scenes) != 2 {
+		t.Fatalf("expected 2 scenes, got %+v", scenes)
+	}
+	if !strings.HasPrefix(scenes[1].Text, "Far away") {
+		t.Fatalf("expected the cut where the story moves to the boat, got %q", scenes[1].Text)
+	}
+	if scenes[0].Start != 0 || scenes[0].End != scenes[1].Start || scenes[1].End != transcript.Segments[0].End {
+		t.Fatalf("expected contiguous scenes covering the narration, got %+v", scenes)
+	}
+
+	many := PlanScenes(transcript, 20, nil)
+	for _, scene := range many {
+		if scene.End-scene.Start < minSceneDuration {
+			t.Fatalf("scene is shorter than %.0fs: %+v", minSceneDuration, scene)
+		}
+	}
+}
+
+func TestPlanScenesFollowsTheStory(t *testing.T) {
+	transcript := spokenTranscript("One two three four five.", "Six seven eight nine ten.", "Eleven twelve thirteen fourteen fifteen.")
+	story := []models.Scene{
+		{Text: "One two three four five. Six seven", Visual: "numbers"},
+		{Text: "eight nine ten. Eleven twelve thirteen fourteen fifteen.", Visual: "more numbers"},
+	}
+
+	scenes := PlanScenes(transcript, 2, story)
+	if len(scenes) != 2 || !strings.HasPrefix(scenes[1].Text, "eight") {
+		t.Fatalf("expected the story boundary to win, got %+v", scenes)
+	}
+	if scenes[0].Visual != "numbers" || scenes[1].Visual != "more numbers" {
+		t.Fatalf("expected the story visuals, got %+v", scenes)
+	}
+}
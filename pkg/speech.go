@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxSpeechChunk is the longest text, in characters, sent to the TTS model at once.
+// XTTS starts truncating English sentences past roughly 250 characters
+const MaxSpeechChunk = 250
+
+// fullWidthPunctuation ends a piece of Chinese or Japanese text, which has no spaces after it
+const fullWidthPunctuation = "。！？；：，、"
+
+// SplitSentences splits text at sentence boundaries, sentences longer than maxChars characters
+// are split again at commas, then between words and, for text without spaces, every maxChars
+func SplitSentences(text string, maxChars int) []string {
+	var chunks []string
+
+	for _, sentence := range splitAfter(text, ".!?…。！？") {
+		if utf8.RuneCountInString(sentence) <= maxChars {
+			chunks = append(chunks, sentence)
+			continue
+		}
+
+		for _, clause := range joinPieces(splitAfter(sentence, ",;:；：，、"), maxChars) {
+			if utf8.RuneCountInString(clause) <= maxChars {
+				chunks = append(chunks, clause)
+				continue
+			}
+
+			var words []string
+			for _, word := range strings.Fields(clause) {
+				words = append(words, splitRunes(word, maxChars)...)
+			}
+			chunks = append(chunks, joinPieces(words, maxChars)...)
+		}
+	}
+
+	return chunks
+}
+
+// SpeechChunks packs consecutive sentences of text into chunks of at most maxChars characters,
+// so the TTS model is called as few times as possible without truncating anything
+func SpeechChunks(text string, maxChars int) []string {
+	return joinPieces(SplitSentences(text, maxChars), maxChars)
+}
+
+// splitAfter cuts text after every run of the given punctuation that is followed by a space,
+// full width punctuation cuts it without one
+func splitAfter(text string, punctuation string) []string {
+	var pieces []string
+	runes := []rune(text)
+	start := 0
+
+	for i, r := range runes {
+		if !strings.ContainsRune(punctuation, r) {
+			continue
+		}
+
+		if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) &&
+			(!strings.ContainsRune(fullWidthPunctuation, r) || strings.ContainsRune(punctuation, runes[i+1])) {
+			continue
+		}
+
+		if piece := strings.TrimSpace(string(runes[start : i+1])); piece != "" {
+			pieces = append(pieces, piece)
+		}
+		start = i + 1
+	}
+
+	if piece := strings.TrimSpace(string(runes[start:])); piece != "" {
+		pieces = append(pieces, piece)
+	}
+
+	return pieces
+}
+
+// splitRunes cuts a word into pieces of at most maxChars characters
+func splitRunes(word string, maxChars int) []string {
+	runes := []rune(word)
+	var pieces []string
+	for len(runes) > maxChars {
+		pieces = append(pieces, string(runes[:maxChars]))
+		runes = runes[maxChars:]
+	}
+	return append(pieces, string(runes))
+}
+
+// joinPieces greedily joins pieces into chunks of at most maxChars characters, with a space
+// between them unless the previous one ends with full width punctuation
+func joinPieces(pieces []string, maxChars int) []string {
+	var chunks []string
+	current := ""
+
+	for _, piece := range pieces {
+		separator := " "
+		if last, _ := utf8.DecodeLastRuneInString(current); strings.ContainsRune(fullWidthPunctuation, last) {
+			separator = ""
+		}
+
+		if current != "" && utf8.RuneCountInString(current)+len(separator)+utf8.RuneCountInString(piece) > maxChars {
+			chunks = append(chunks, current)
+			current = ""
+		}
+
+		if current == "" {
+			current = piece
+		} else {
+			current += separator + piece
+		}
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitSentences(t *testing.T) {
+	chunks := SplitSentences("Hello there. How are you? Version 1.5 is out!", MaxSpeechChunk)
+	expected := []string{"Hello there.", "How are you?", "Version 1.5 is out!"}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %q, got %q", expected, chunks)
+	}
+
+	long := strings.Repeat("word ", 30) + "and then, " + strings.Repeat("more ", 30)
+	for _, chunk := range SplitSentences(long, 60) {
+		if len(chunk) > 60 {
+			t.Fatalf("chunk is longer than 60 characters: %q", chunk)
+		}
+	}
+}
+
+func TestSpeechChunksPackSentences(t *testing.T) {
+	text := "One two three. Four five six. Seven eight nine. Ten."
+	chunks := SpeechChunks(text, 30)
+	expected := []string{"One two three. Four five six.", "Seven eight nine. Ten."}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %q, got %q", expected, chunks)
+	}
+
+	long := strings.Repeat("A short sentence. ", 40)
+	for _, chunk := range SpeechChunks(long, MaxSpeechChunk) {
+		if len(chunk) > MaxSpeechChunk || !strings.HasSuffix(chunk, ".") {
+			t.Fatalf("expected whole sentences within %d characters, got %q", MaxSpeechChunk, chunk)
+		}
+	}
+}
+
+func TestSplitSentencesWithoutSpaces(t *testing.T) {
+	chunks := SplitSentences("今天天气很好。我们去公园吧！你觉得呢？", MaxSpeechChunk)
+	expected := []string{"今天天气很好。", "我们去公园吧！", "你觉得呢？"}
+	if strings.Join(chunks, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %q, got %q", expected, chunks)
+	}
+
+	long := strings.Repeat("長い文章", 30)
+	for _, chunk := range SplitSentences(long, 50) {
+		if utf8.RuneCountInString(chunk) > 50 {
+			t.Fatalf("chunk is longer than 50 characters: %q", chunk)
+		}
+	}
+
+	packed := SpeechChunks("今天天气很好。我们去公园吧！", MaxSpeechChunk)
+	if len(packed) != 1 || packed[0] != "今天天气很好。我们去公园吧！" {
+		t.Fatalf("expected the sentences joined without a space, got %q", packed)
+	}
+}
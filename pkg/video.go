@@ -1,30 +1,87 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	gobra "github.com/thedekerone/gobra/video"
 	"github.com/thedekerone/shorts-maker/models"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-func MakeVideoOfImages(imagesWithTS []models.ImageWithTimestamp, duration float32, outputFolder string) (string, error) {
-	images := make([]string, len(imagesWithTS))
-	for i, image := range imagesWithTS {
-		uniqueName := generateUniqueName()
-		fileName := filepath.Join(outputFolder, fmt.Sprintf("%s.jpg", uniqueName))
-		err := DownloadFile(image.URL, fileName)
-		if err != nil {
-			return "", fmt.Errorf("failed to download image %s: %v", image.URL, err)
-		}
-		images[i] = fileName
+// VideoOptions controls the frame size and container of rendered videos
+type VideoOptions struct {
+	Width  int
+	Height int
+	Fps    int
+	// Format is the container of the final video: mp4, mov or webm
+	Format string
+	// BurnSubtitles draws the subtitles into the frames, otherwise they are only muxed as a soft track
+	BurnSubtitles bool
+	// FontsDir holds fonts the subtitles can use besides the system ones
+	FontsDir string
+	// Music is mixed under the narration and ducked while it is speaking
+	Music *MusicBed
+	// Loudness is the integrated loudness target of the final mix in LUFS, 0 leaves the level alone
+	Loudness float64
+}
+
+// MusicBed is a background track for the narration
+type MusicBed struct {
+	URL string
+	// Volume is the gain in dB applied to the track before ducking
+	Volume float64
+	// Duration of the narration in seconds, the track is looped and cut to it
+	Duration float64
+}
+
+// musicFade is how long the music takes to fade in and out, in seconds
+const musicFade = 1.5
+
+var DefaultVideoOptions = VideoOptions{
+	Width:         1080,
+	Height:        1920,
+	Fps:           30,
+	Format:        "mp4",
+	BurnSubtitles: true,
+}
+
+var formatCodecs = map[string]ffmpeg.KwArgs{
+	"mp4":  {"c:v": "libx264", "c:a": "aac"},
+	"mov":  {"c:v": "libx264", "c:a": "aac"},
+	"webm": {"c:v": "libvpx-vp9", "c:a": "libopus"},
+}
+
+var subtitleCodecs = map[string]string{
+	"mp4":  "mov_text",
+	"mov":  "mov_text",
+	"webm": "webvtt",
+}
+
+// ContentType returns the MIME type of a video in the given format
+func ContentType(format string) string {
+	switch format {
+	case "mov":
+		return "video/quicktime"
+	case "webm":
+		return "video/webm"
+	default:
+		return "video/mp4"
 	}
+}
+
+func MakeVideoOfImages(ctx context.Context, imagesWithTS []models.ImageWithTimestamp, duration float32, options VideoOptions, outputFolder string) (string, error) {
+	images := make([]string, 0, len(imagesWithTS))
 
 	defer func() {
 		// Delete all created images
@@ -35,77 +92,215 @@ func MakeVideoOfImages(imagesWithTS []models.ImageWithTimestamp, duration float3
 		}
 	}()
 
-	var video []*gobra.Video
+	for _, image := range imagesWithTS {
+		uniqueName := generateUniqueName()
+		fileName := filepath.Join(outputFolder, fmt.Sprintf("%s.jpg", uniqueName))
+		images = append(images, fileName)
+		err := DownloadFile(ctx, image.URL, fileName)
+		if err != nil {
+			return "", fmt.Errorf("failed to download image %s: %v", image.URL, err)
+		}
+	}
+
 	config := gobra.Config{
-		Width:       1080,
-		Height:      1920,
-		Fps:         30,
-		AspectRatio: 9.0 / 16.0,
+		Width:       options.Width,
+		Height:      options.Height,
+		Fps:         options.Fps,
+		AspectRatio: float64(options.Width) / float64(options.Height),
 	}
-	interval := float32(duration)/float32(len(images)) + 0.2
-	for _, image := range images {
-		currentVideo := gobra.NewZoomPanVideoFromImage(image, interval, 1.3, config)
-		currentVideo = currentVideo.AddFadeIn(0.2)
-		currentVideo = currentVideo.AddFadeOut(0.2)
-		video = append(video, currentVideo)
+	var clips []*ffmpeg.Stream
+	for i, image := range images {
+		clips = append(clips, zoomPanClip(image, clipDuration(imagesWithTS, i, duration), 1.3, 0.2, config))
 	}
-	merged := gobra.MergeVideos(video...)
 
 	outputFile := filepath.Join(outputFolder, fmt.Sprintf("%s.mp4", generateUniqueName()))
-	merged.Save(outputFile)
+	err := ffmpeg.OutputContext(ctx, []*ffmpeg.Stream{ffmpeg.Concat(clips)}, outputFile).
+		WithOutput(bytes.NewBuffer(nil), os.Stdout).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		removeOnCancel(ctx, outputFile)
+		return "", fmt.Errorf("failed to render video: %w", err)
+	}
+
 	return outputFile, nil
 }
 
+// clipDuration is how long image i stays on screen, images planned without a duration split the
+// video evenly. The last clip runs a little long so the video never ends before the narration
+func clipDuration(images []models.ImageWithTimestamp, i int, total float32) float32 {
+	clip := total / float32(len(images))
+	if images[i].Duration > 0 {
+		clip = float32(images[i].Duration)
+	}
+	if i == len(images)-1 {
+		clip += 0.2
+	}
+	return clip
+}
+
+// zoomPanClip turns a still image into a slowly zooming clip of the given duration
+// that fades in and out, the image is cropped to fill the configured frame
+func zoomPanClip(path string, duration, zoom, fade float32, config gobra.Config) *ffmpeg.Stream {
+	// zoompan works on whole pixels, upscaling first keeps the zoom from jittering
+	width, height := fmt.Sprintf("%d", config.Width*4), fmt.Sprintf("%d", config.Height*4)
+
+	return ffmpeg.Input(path).
+		Filter("scale", ffmpeg.Args{width, height, "force_original_aspect_ratio=increase"}).
+		Filter("crop", ffmpeg.Args{width, height}).
+		Filter("zoompan", ffmpeg.Args{
+			fmt.Sprintf("z=min(max(pzoom,zoom) + 0.001,%f)", zoom),
+			fmt.Sprintf("fps=%d", config.Fps),
+			fmt.Sprintf("d=%.2f*%d", math.Ceil(float64(duration)*100)/100, config.Fps),
+			"x=iw/2-(iw/zoom/2)",
+			fmt.Sprintf("s=%dx%d", config.Width, config.Height),
+		}).
+		Filter("setsar", ffmpeg.Args{"1"}).
+		Filter("fade", ffmpeg.Args{"t=in", fmt.Sprintf("d=%f", fade)}).
+		Filter("fade", ffmpeg.Args{"t=out", fmt.Sprintf("d=%f", fade), fmt.Sprintf("st=%f", duration-fade)})
+}
+
 func generateUniqueName() string {
 	timestamp := time.Now().UnixNano()
 	uuid := uuid.New().String()
 	return fmt.Sprintf("%d_%s", timestamp, uuid)
 }
 
-func AddAudioToVideo(videoPath, audioPath, subtitlesPath, outputFolder string) (string, error) {
+// AddAudioToVideo muxes the audio, mixed with options.Music when set, into the video and burns in
+// the subtitles unless options.BurnSubtitles is off, an empty subtitlesPath leaves the video without captions
+func AddAudioToVideo(ctx context.Context, videoPath, audioPath, subtitlesPath string, options VideoOptions, outputFolder string) (string, error) {
+	codecs, ok := formatCodecs[options.Format]
+	if !ok {
+		return "", fmt.Errorf("unsupported output format %q", options.Format)
+	}
+
 	// Generate unique names for temporary audio file and output video file
-	audioFileName := fmt.Sprintf("%s.mp3", generateUniqueName())
-	outputFileName := fmt.Sprintf("%s.mp4", generateUniqueName())
+	audioFileName := generateUniqueName() + audioExt(audioPath)
+	outputFileName := fmt.Sprintf("%s.%s", generateUniqueName(), options.Format)
 
 	// Full paths for the files
 	audioFilePath := filepath.Join(outputFolder, audioFileName)
 	outputFilePath := filepath.Join(outputFolder, outputFileName)
 
+	// Defer cleanup of temporary audio file
+	defer func() {
+		if err := os.Remove(audioFilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Failed to remove temporary audio file: %v\n", err)
+		}
+	}()
+
 	// Download audio file
-	err := DownloadFile(audioPath, audioFilePath)
+	err := DownloadFile(ctx, audioPath, audioFilePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to download audio file: %v", err)
 	}
 
-	// Defer cleanup of temporary audio file
-	defer func() {
-		if err := os.Remove(audioFilePath); err != nil {
-			fmt.Printf("Failed to remove temporary audio file: %v\n", err)
+	musicFilePath := ""
+	if options.Music != nil {
+		musicFilePath = filepath.Join(outputFolder, generateUniqueName()+audioExt(options.Music.URL))
+		defer os.Remove(musicFilePath)
+
+		if err := DownloadFile(ctx, options.Music.URL, musicFilePath); err != nil {
+			return "", fmt.Errorf("failed to download music %s: %v", options.Music.URL, err)
+		}
+	}
+
+	streams := []*ffmpeg.Stream{ffmpeg.Input(videoPath).Video(), mixAudio(audioFilePath, musicFilePath, options)}
+
+	// stop at the end of the narration instead of the slightly longer slideshow
+	outputArgs := codecs.Copy()
+	outputArgs["shortest"] = ""
+	if options.Loudness != 0 {
+		// loudnorm upsamples to 192 kHz
+		outputArgs["ar"] = 48000
+	}
+
+	if subtitlesPath != "" {
+		if options.BurnSubtitles {
+			filter := fmt.Sprintf("subtitles=%s", subtitlesPath)
+			if options.FontsDir != "" {
+				filter += ":fontsdir=" + options.FontsDir
+			}
+			outputArgs["vf"] = filter
 		}
-	}()
 
-	video := gobra.NewVideoWithAudio(videoPath, audioFilePath, gobra.Config{
-		Width:       1080,
-		Height:      1920,
-		Fps:         30,
-		AspectRatio: 9.0 / 16.0,
-	})
+		// also ship the captions as a soft track that players can toggle
+		streams = append(streams, ffmpeg.Input(subtitlesPath))
+		outputArgs["c:s"] = subtitleCodecs[options.Format]
+	}
 
 	// Save video with subtitles
-	if err := video.SaveWithSubtitles(outputFilePath, subtitlesPath); err != nil {
+	err = ffmpeg.OutputContext(ctx, streams, outputFilePath, outputArgs).
+		WithOutput(bytes.NewBuffer(nil), os.Stdout).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		removeOnCancel(ctx, outputFilePath)
 		return "", fmt.Errorf("failed to save video with subtitles: %v", err)
 	}
 
 	return outputFilePath, nil
 }
 
-func DownloadFile(url, fileName string) error {
-	response, err := http.Get(url)
+// mixAudio ducks the music under the voice while it speaks, fading the music in and out,
+// and normalizes the mix to options.Loudness
+func mixAudio(voicePath, musicPath string, options VideoOptions) *ffmpeg.Stream {
+	mix := ffmpeg.Input(voicePath).Audio()
+
+	if musicPath != "" {
+		music := options.Music
+		voice := mix.Filter("aformat", ffmpeg.Args{"sample_rates=48000:channel_layouts=stereo"}).ASplit()
+
+		bed := ffmpeg.Input(musicPath, ffmpeg.KwArgs{"stream_loop": -1}).Audio().
+			Filter("aformat", ffmpeg.Args{"sample_rates=48000:channel_layouts=stereo"}).
+			Filter("volume", ffmpeg.Args{fmt.Sprintf("%.1fdB", music.Volume)}).
+			Filter("afade", ffmpeg.Args{"t=in", fmt.Sprintf("d=%.1f", musicFade)})
+		if music.Duration > 0 {
+			bed = bed.
+				Filter("atrim", ffmpeg.Args{fmt.Sprintf("duration=%.3f", music.Duration)}).
+				Filter("afade", ffmpeg.Args{"t=out", fmt.Sprintf("st=%.3f", math.Max(music.Duration-musicFade, 0)), fmt.Sprintf("d=%.1f", musicFade)})
+		}
+
+		// the voice is the side chain, the music drops by up to 8:1 as soon as it speaks
+		ducked := ffmpeg.Filter([]*ffmpeg.Stream{bed, voice.Get("1")}, "sidechaincompress", ffmpeg.Args{"threshold=0.02:ratio=8:attack=20:release=400"})
+		mix = ffmpeg.Filter([]*ffmpeg.Stream{voice.Get("0"), ducked}, "amix", ffmpeg.Args{"inputs=2:duration=first:dropout_transition=0:normalize=0"})
+	}
+
+	if options.Loudness != 0 {
+		mix = mix.Filter("loudnorm", ffmpeg.Args{fmt.Sprintf("I=%.1f:TP=-1.5:LRA=11", options.Loudness)})
+	}
+
+	return mix
+}
+
+// removeOnCancel deletes a partially written output when ffmpeg was killed by ctx
+func removeOnCancel(ctx context.Context, path string) {
+	if ctx.Err() != nil {
+		os.Remove(path)
+	}
+}
+
+// DownloadFile saves url into fileName, file:// URLs are copied from the local disk
+func DownloadFile(ctx context.Context, url, fileName string) error {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return copyFile(path, fileName)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := http.DefaultClient.Do(request)
 	if err != nil {
 		return err
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status downloading %s: %s", url, response.Status)
+	}
+
 	file, err := os.Create(fileName)
 	if err != nil {
 		return err
@@ -113,39 +308,89 @@ func DownloadFile(url, fileName string) error {
 	defer file.Close()
 
 	_, err = io.Copy(file, response.Body)
+	if err != nil {
+		os.Remove(fileName)
+	}
 	return err
 }
 
-func MergeAudios(audioUrls []string, outputFolder string) (string, error) {
-	var audios []*gobra.Audio
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		os.Remove(destination)
+		return err
+	}
+	return nil
+}
+
+// MergeAudios downloads the audios and joins them in order with silence seconds of silence
+// between each, the result is a mono WAV in outputFolder
+func MergeAudios(ctx context.Context, audioUrls []string, silence float64, outputFolder string) (string, error) {
+	if len(audioUrls) == 0 {
+		return "", fmt.Errorf("no audios to merge")
+	}
+
+	var streams []*ffmpeg.Stream
 	var tempFiles []string
 
-	for _, url := range audioUrls {
-		randomName := GenerateRandomString(8)
-		fileName := fmt.Sprintf("%s%s.mp3", outputFolder, randomName)
-		err := DownloadFile(url, fileName)
-		if err != nil {
-			return "", fmt.Errorf("failed to download audio %s: %v", url, err)
+	defer func() {
+		for _, file := range tempFiles {
+			os.Remove(file)
 		}
-		audio := gobra.NewAudio(fileName)
-		audios = append(audios, audio)
+	}()
+
+	for i, url := range audioUrls {
+		fileName := filepath.Join(outputFolder, generateUniqueName()+audioExt(url))
 		tempFiles = append(tempFiles, fileName)
-	}
 
-	outputPath := outputFolder + "merged_audio.mp3"
-	err := gobra.MergeAudios(outputPath, audios...)
+		err := DownloadFile(ctx, url, fileName)
+		if err != nil {
+			return "", fmt.Errorf("failed to download audio %s: %v", url, err)
+		}
 
-	for _, file := range tempFiles {
-		os.Remove(file)
+		// chunks can come back with different rates, concat needs them to match
+		stream := ffmpeg.Input(fileName).Audio().Filter("aformat", ffmpeg.Args{"sample_rates=24000:channel_layouts=mono"})
+		if silence > 0 && i < len(audioUrls)-1 {
+			stream = stream.Filter("apad", ffmpeg.Args{fmt.Sprintf("pad_dur=%.3f", silence)})
+		}
+		streams = append(streams, stream)
 	}
 
+	outputPath := filepath.Join(outputFolder, generateUniqueName()+".wav")
+
+	err := ffmpeg.OutputContext(ctx, []*ffmpeg.Stream{ffmpeg.Concat(streams, ffmpeg.KwArgs{"v": 0, "a": 1})}, outputPath, ffmpeg.KwArgs{"c:a": "pcm_s16le"}).
+		WithOutput(bytes.NewBuffer(nil), os.Stdout).
+		OverWriteOutput().
+		Run()
 	if err != nil {
-		return "", err
+		removeOnCancel(ctx, outputPath)
+		return "", fmt.Errorf("failed to merge audios: %v", err)
 	}
 
 	return outputPath, nil
 }
 
+// audioExt keeps the extension of an audio URL so ffmpeg picks the right demuxer, ignoring query strings
+func audioExt(url string) string {
+	path, _, _ := strings.Cut(url, "?")
+	ext := filepath.Ext(path)
+	if len(ext) < 2 || len(ext) > 5 {
+		return ".audio"
+	}
+	return ext
+}
+
 func GenerateRandomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	result := make([]byte, length)
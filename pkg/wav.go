@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WavInfo describes the audio stored in a WAV file
+type WavInfo struct {
+	Format        uint16
+	Channels      uint16
+	SampleRate    uint32
+	BitsPerSample uint16
+	DataSize      uint32
+	// Duration is in seconds
+	Duration float64
+}
+
+// ReadWavInfo reads the fmt and data chunk headers of a RIFF/WAVE file, the data is read
+// through so the size and duration are those of the bytes actually there, not the header's
+func ReadWavInfo(r io.Reader) (WavInfo, error) {
+	var info WavInfo
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return info, errors.New("file is too short to be a WAV")
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return info, errors.New("file is not a RIFF/WAVE file")
+	}
+
+	foundFormat := false
+	chunk := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return info, errors.New("WAV has no data chunk")
+		}
+
+		id := string(chunk[0:4])
+		size := binary.LittleEndian.Uint32(chunk[4:8])
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return info, errors.New("WAV fmt chunk has an invalid size")
+			}
+			format := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return info, errors.New("WAV fmt chunk is truncated")
+			}
+			info.Format = binary.LittleEndian.Uint16(format[0:])
+			info.Channels = binary.LittleEndian.Uint16(format[2:])
+			info.SampleRate = binary.LittleEndian.Uint32(format[4:])
+			info.BitsPerSample = binary.LittleEndian.Uint16(format[14:])
+			foundFormat = true
+
+		case "data":
+			if !foundFormat {
+				return info, errors.New("WAV data chunk comes before the fmt chunk")
+			}
+			// a truncated or forged upload can claim far more data than it has
+			available, err := io.CopyN(io.Discard, r, int64(size))
+			if err != nil && err != io.EOF {
+				return info, err
+			}
+			info.DataSize = uint32(available)
+
+			bytesPerSecond := float64(info.SampleRate) * float64(info.Channels) * float64(info.BitsPerSample) / 8
+			if bytesPerSecond == 0 {
+				return info, fmt.Errorf("WAV has an invalid format: %d channels at %d Hz", info.Channels, info.SampleRate)
+			}
+			info.Duration = float64(info.DataSize) / bytesPerSecond
+
+			return info, nil
+
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+				return info, errors.New("WAV is truncated")
+			}
+		}
+	}
+}
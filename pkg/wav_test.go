@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestReadWavInfo(t *testing.T) {
+	var wav bytes.Buffer
+	pcm := make([]byte, 44100*2*2*3) // 3 seconds of 16 bit stereo
+
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(4+8+16+8+5+1+8+len(pcm)))
+	wav.WriteString("WAVE")
+	wav.WriteString("fmt ")
+	binary.Write(&wav, binary.LittleEndian, uint32(16))
+	binary.Write(&wav, binary.LittleEndian, uint16(1))
+	binary.Write(&wav, binary.LittleEndian, uint16(2))
+	binary.Write(&wav, binary.LittleEndian, uint32(44100))
+	binary.Write(&wav, binary.LittleEndian, uint32(44100*4))
+	binary.Write(&wav, binary.LittleEndian, uint16(4))
+	binary.Write(&wav, binary.LittleEndian, uint16(16))
+	// an odd sized chunk before the data has to be skipped with its padding
+	wav.WriteString("LIST")
+	binary.Write(&wav, binary.LittleEndian, uint32(5))
+	wav.Write([]byte{1, 2, 3, 4, 5, 0})
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(len(pcm)))
+	wav.Write(pcm)
+
+	info, err := ReadWavInfo(bytes.NewReader(wav.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Format != 1 || info.Channels != 2 || info.SampleRate != 44100 || info.BitsPerSample != 16 {
+		t.Fatalf("unexpected format: %+v", info)
+	}
+	if math.Abs(info.Duration-3) > 0.001 {
+		t.Fatalf("expected 3 seconds, got %f", info.Duration)
+	}
+
+	// a header that claims a minute of audio with 3 seconds of data
+	truncated := bytes.Clone(wav.Bytes())
+	binary.LittleEndian.PutUint32(truncated[len(truncated)-len(pcm)-4:], uint32(44100*4*60))
+	info, err = ReadWavInfo(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(info.Duration-3) > 0.001 || info.DataSize != uint32(len(pcm)) {
+		t.Fatalf("expected the duration of the bytes received, got %f", info.Duration)
+	}
+
+	if _, err := ReadWavInfo(bytes.NewReader([]byte("ID3\x04 not a wav file"))); err == nil {
+		t.Fatal("expected an error for a file that isn't a WAV")
+	}
+}
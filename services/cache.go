@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by a CacheStore that doesn't have the key
+var ErrCacheMiss = errors.New("cache miss")
+
+const (
+	// evictionInterval keeps the stores from being listed after every single write
+	evictionInterval = time.Minute
+	// filesInUse is how long a file written back to disk is protected from the size limit
+	filesInUse = time.Hour
+)
+
+// CacheStore holds cached model outputs, keys may contain slashes
+type CacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, time.Time, error)
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) ([]CacheEntry, error)
+}
+
+// CacheEntry is a stored key with its size in bytes and when it was written
+type CacheEntry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Cache keeps model outputs so identical requests aren't paid for twice. Entries older
+// than TTL are ignored and removed, and the oldest ones go once the store together with
+// the files in FilesDir is over MaxBytes
+type Cache struct {
+	Store    CacheStore
+	TTL      time.Duration
+	MaxBytes int64
+	// FilesDir is where cached media is written back to disk for the pipeline to read
+	FilesDir string
+
+	mu           sync.Mutex
+	lastEviction time.Time
+}
+
+// NewCache reads CACHE_TTL (a duration, 168h by default) and CACHE_MAX_MB (5120 by default),
+// cached media is written back to disk under CacheDir
+func NewCache(store CacheStore) (*Cache, error) {
+	ttl, err := time.ParseDuration(envOrDefault("CACHE_TTL", "168h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CACHE_TTL: %w", err)
+	}
+
+	var maxMB int64
+	if _, err := fmt.Sscan(envOrDefault("CACHE_MAX_MB", "5120"), &maxMB); err != nil {
+		return nil, fmt.Errorf("invalid CACHE_MAX_MB: %w", err)
+	}
+
+	filesDir := filepath.Join(CacheDir(), "files")
+	if err := os.MkdirAll(filesDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Cache{Store: store, TTL: ttl, MaxBytes: maxMB << 20, FilesDir: filesDir}, nil
+}
+
+// CacheDir is CACHE_DIR, the system temp directory by default
+func CacheDir() string {
+	return envOrDefault("CACHE_DIR", filepath.Join(os.TempDir(), "shorts-maker-cache"))
+}
+
+// CacheKey hashes the model identifier together with every input that changes its output
+func CacheKey(model string, inputs ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(model))
+	for _, input := range inputs {
+		hash.Write([]byte{0})
+		hash.Write([]byte(input))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns the data stored under key, expired entries are a miss
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, written, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.TTL > 0 && time.Since(written) > c.TTL {
+		c.Store.Delete(ctx, key)
+		return nil, ErrCacheMiss
+	}
+
+	return data, nil
+}
+
+// Put stores data under key and evicts old entries when it's been a while since the last time
+func (c *Cache) Put(ctx context.Context, key string, data []byte) error {
+	if err := c.Store.Put(ctx, key, data); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	due := time.Since(c.lastEviction) > evictionInterval
+	if due {
+		c.lastEviction = time.Now()
+	}
+	c.mu.Unlock()
+
+	if due {
+		if err := c.Evict(ctx); err != nil {
+			log.Printf("failed to evict cache entries: %v", err)
+		}
+	}
+	return nil
+}
+
+// Evict removes the expired entries, then the oldest ones until the store fits in MaxBytes
+func (c *Cache) Evict(ctx context.Context) error {
+	entries, err := c.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime.Before(entries[j].ModTime) })
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	for _, entry := range entries {
+		expired := c.TTL > 0 && time.Since(entry.ModTime) > c.TTL
+		tooBig := c.MaxBytes > 0 && total > c.MaxBytes
+		if !expired && !tooBig {
+			break
+		}
+
+		if err := c.Store.Delete(ctx, entry.Key); err != nil {
+			return err
+		}
+		total -= entry.Size
+	}
+
+	c.pruneFiles(total)
+	return nil
+}
+
+// pruneFiles removes the media written back to disk that no job asked for within TTL, then the
+// least recently used until they fit next to the store in MaxBytes. Files used within
+// filesInUse are kept, a running job may still read them
+func (c *Cache) pruneFiles(storeSize int64) {
+	if c.FilesDir == "" {
+		return
+	}
+
+	entries, err := os.ReadDir(c.FilesDir)
+	if err != nil {
+		return
+	}
+
+	var files []fs.FileInfo
+	var total int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !info.IsDir() {
+			files = append(files, info)
+			total += info.Size()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	for _, file := range files {
+		age := time.Since(file.ModTime())
+		expired := c.TTL > 0 && age > c.TTL
+		tooBig := c.MaxBytes > 0 && storeSize+total > c.MaxBytes && age > filesInUse
+		if !expired && !tooBig {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(c.FilesDir, file.Name())); err == nil {
+			total -= file.Size()
+		}
+	}
+}
+
+// DiskCacheStore keeps every entry as a file under Dir
+type DiskCacheStore struct {
+	Dir string
+}
+
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCacheStore{Dir: dir}, nil
+}
+
+func (s *DiskCacheStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+func (s *DiskCacheStore) Get(ctx context.Context, key string) ([]byte, time.Time, error) {
+	info, err := os.Stat(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err := os.ReadFile(s.path(key))
+	return data, info.ModTime(), err
+}
+
+// Put writes to a temporary file first so readers never see half an entry
+func (s *DiskCacheStore) Put(ctx context.Context, key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DiskCacheStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *DiskCacheStore) List(ctx context.Context) ([]CacheEntry, error) {
+	var entries []CacheEntry
+
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		key, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, CacheEntry{Key: filepath.ToSlash(key), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+
+	return entries, err
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// CacheRecorder counts the cache hits and misses of one job per capability
+type CacheRecorder struct {
+	mu    sync.Mutex
+	stats map[string]models.CacheStats
+}
+
+func (r *CacheRecorder) record(capability string, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats[capability]
+	if hit {
+		stats.Hits++
+	} else {
+		stats.Misses++
+	}
+	r.stats[capability] = stats
+}
+
+// Stats returns a copy of the counts so far
+func (r *CacheRecorder) Stats() map[string]models.CacheStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]models.CacheStats, len(r.stats))
+	for capability, s := range r.stats {
+		stats[capability] = s
+	}
+	return stats
+}
+
+// WithCache wraps every provider so identical requests are answered from cache, keyed by
+// the model each provider uses. Media is downloaded into the cache and served from disk
+func WithCache(providers *Providers, cache *Cache) (*Providers, *CacheRecorder) {
+	recorder := &CacheRecorder{stats: make(map[string]models.CacheStats)}
+
+	return &Providers{
+		Text:        &cachedText{next: providers.Text, cache: cache, recorder: recorder, model: modelID(providers.Text, "text")},
+		Speech:      &cachedSpeech{next: providers.Speech, cache: cache, recorder: recorder, model: modelID(providers.Speech, "speech")},
+		Transcriber: &cachedTranscriber{next: providers.Transcriber, cache: cache, recorder: recorder, model: modelID(providers.Transcriber, "transcription")},
+		Images:      &cachedImages{next: providers.Images, cache: cache, recorder: recorder, model: modelID(providers.Images, "images")},
+	}, recorder
+}
+
+// modelID names the model behind a provider, providers that can't tell are named by their type
+func modelID(provider any, capability string) string {
+	if identified, ok := provider.(interface {
+		ModelID(capability string) string
+	}); ok {
+		return identified.ModelID(capability)
+	}
+	return fmt.Sprintf("%T", provider)
+}
+
+// uncheckedAnswers marks a context whose completions are validated by the caller,
+// they are only cached once the caller remembers the one it accepted
+type uncheckedAnswers struct{}
+
+// withUncheckedAnswers keeps the answers of text generators under ctx out of the cache
+func withUncheckedAnswers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncheckedAnswers{}, true)
+}
+
+// answerCache is implemented by text generators that can be told which answer was valid
+type answerCache interface {
+	RememberCompletition(ctx context.Context, prompt string, systemPrompt string, answer string)
+}
+
+type cachedText struct {
+	next     TextGenerator
+	cache    *Cache
+	recorder *CacheRecorder
+	model    string
+}
+
+func (t *cachedText) GetCompletition(ctx context.Context, prompt string, systemPrompt string) (string, error) {
+	key := "text/" + CacheKey(t.model, prompt, systemPrompt)
+
+	if data, ok := t.cache.lookup(ctx, key); ok {
+		t.recorder.record("text", true)
+		return string(data), nil
+	}
+	t.recorder.record("text", false)
+
+	answer, err := t.next.GetCompletition(ctx, prompt, systemPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	if ctx.Value(uncheckedAnswers{}) == nil {
+		t.cache.store(ctx, key, []byte(answer))
+	}
+	return answer, nil
+}
+
+// RememberCompletition caches answer as the one for prompt, after the caller validated it
+func (t *cachedText) RememberCompletition(ctx context.Context, prompt string, systemPrompt string, answer string) {
+	t.cache.store(ctx, "text/"+CacheKey(t.model, prompt, systemPrompt), []byte(answer))
+}
+
+type cachedSpeech struct {
+	next     SpeechSynthesizer
+	cache    *Cache
+	recorder *CacheRecorder
+	model    string
+}
+
+// GetVoice is keyed by the content of uploaded speaker samples, they are copied into a new
+// work directory for every job
+func (s *cachedSpeech) GetVoice(ctx context.Context, text string, options VoiceOptions) (string, error) {
+	speaker, err := inputKey(options.Speaker)
+	if err != nil {
+		return "", err
+	}
+	key := "speech/" + CacheKey(s.model, text, speaker, options.Language)
+
+	if urls, ok := s.cache.getMedia(ctx, key); ok && len(urls) == 1 {
+		s.recorder.record("speech", true)
+		return urls[0], nil
+	}
+	s.recorder.record("speech", false)
+
+	voice, err := s.next.GetVoice(ctx, text, options)
+	if err != nil {
+		return "", err
+	}
+
+	s.cache.putMedia(ctx, key, []string{voice})
+	return voice, nil
+}
+
+type cachedTranscriber struct {
+	next     Transcriber
+	cache    *Cache
+	recorder *CacheRecorder
+	model    string
+}
+
+// GetTranscription is keyed by the audio itself, the same narration lives in a different
+// work directory every time it is rendered
+func (t *cachedTranscriber) GetTranscription(ctx context.Context, audio string, initial string, language string) (*models.TranscriptionOutput, error) {
+	audioKey, err := inputKey(audio)
+	if err != nil {
+		return nil, err
+	}
+	key := "transcription/" + CacheKey(t.model, audioKey, initial, language)
+
+	if data, ok := t.cache.lookup(ctx, key); ok {
+		var transcript models.TranscriptionOutput
+		if err := json.Unmarshal(data, &transcript); err == nil {
+			t.recorder.record("transcription", true)
+			return &transcript, nil
+		}
+	}
+	t.recorder.record("transcription", false)
+
+	transcript, err := t.next.GetTranscription(ctx, audio, initial, language)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(transcript); err == nil {
+		t.cache.store(ctx, key, data)
+	}
+	return transcript, nil
+}
+
+type cachedImages struct {
+	next     ImageGenerator
+	cache    *Cache
+	recorder *CacheRecorder
+	model    string
+}
+
+func (i *cachedImages) GetImages(ctx context.Context, prompt string, quantity int64, options ImageOptions) ([]string, error) {
+	seed := ""
+	if options.Seed != nil {
+		seed = fmt.Sprint(*options.Seed)
+	}
+	key := "images/" + CacheKey(i.model, prompt, fmt.Sprint(quantity), options.AspectRatio, seed)
+
+	if urls, ok := i.cache.getMedia(ctx, key); ok && int64(len(urls)) == quantity {
+		i.recorder.record("images", true)
+		return urls, nil
+	}
+	i.recorder.record("images", false)
+
+	images, err := i.next.GetImages(ctx, prompt, quantity, options)
+	if err != nil {
+		return nil, err
+	}
+
+	i.cache.putMedia(ctx, key, images)
+	return images, nil
+}
+
+// lookup is Get where a broken cache is only logged, the provider answers instead
+func (c *Cache) lookup(ctx context.Context, key string) ([]byte, bool) {
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrCacheMiss) {
+			log.Printf("failed to read cache entry %s: %v", key, err)
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// store is Put where a broken cache is only logged
+func (c *Cache) store(ctx context.Context, key string, data []byte) {
+	if err := c.Put(ctx, key, data); err != nil {
+		log.Printf("failed to write cache entry %s: %v", key, err)
+	}
+}
+
+// putMedia downloads every url into a blob named by its content, key lists the blobs
+func (c *Cache) putMedia(ctx context.Context, key string, urls []string) {
+	var blobs []string
+
+	for _, u := range urls {
+		data, err := readURL(ctx, u)
+		if err != nil {
+			log.Printf("failed to download %s into the cache: %v", u, err)
+			return
+		}
+
+		blob := "blobs/" + contentKey(data) + mediaExt(u)
+		if err := c.Put(ctx, blob, data); err != nil {
+			log.Printf("failed to write cache entry %s: %v", blob, err)
+			return
+		}
+		blobs = append(blobs, blob)
+	}
+
+	manifest, err := json.Marshal(blobs)
+	if err != nil {
+		return
+	}
+	c.store(ctx, key, manifest)
+}
+
+// getMedia writes the blobs listed under key into FilesDir and returns their file:// URLs,
+// a blob that was evicted on its own makes the whole entry a miss
+func (c *Cache) getMedia(ctx context.Context, key string) ([]string, bool) {
+	manifest, ok := c.lookup(ctx, key)
+	if !ok {
+		return nil, false
+	}
+
+	var blobs []string
+	if err := json.Unmarshal(manifest, &blobs); err != nil {
+		return nil, false
+	}
+
+	var urls []string
+	for _, blob := range blobs {
+		local := filepath.Join(c.FilesDir, path.Base(blob))
+
+		if _, err := os.Stat(local); err == nil {
+			now := time.Now()
+			os.Chtimes(local, now, now)
+		} else {
+			data, ok := c.lookup(ctx, blob)
+			if !ok {
+				return nil, false
+			}
+			if err := os.WriteFile(local, data, 0o644); err != nil {
+				log.Printf("failed to write cached file %s: %v", local, err)
+				return nil, false
+			}
+		}
+
+		urls = append(urls, "file://"+local)
+	}
+
+	return urls, true
+}
+
+// inputKey is what a media input is cached by, the content of local files and the URL otherwise
+func inputKey(url string) (string, error) {
+	path, ok := strings.CutPrefix(url, "file://")
+	if !ok {
+		return url, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return contentKey(data), nil
+}
+
+func contentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// mediaExt keeps the extension of a URL so the cached copy is recognized by ffmpeg
+func mediaExt(u string) string {
+	p := u
+	if parsed, err := url.Parse(u); err == nil {
+		p = parsed.Path
+	}
+
+	ext := path.Ext(p)
+	if len(ext) > 6 {
+		return ""
+	}
+	return ext
+}
+
+// readURL returns the content of an http(s) or file:// URL
+func readURL(ctx context.Context, u string) ([]byte, error) {
+	if p, ok := strings.CutPrefix(u, "file://"); ok {
+		return os.ReadFile(p)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", response.Status)
+	}
+
+	return io.ReadAll(response.Body)
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingImages writes one file per call so a cached answer can be told apart
+type countingImages struct {
+	dir   string
+	calls int
+}
+
+func (c *countingImages) GetImages(ctx context.Context, prompt string, quantity int64, options ImageOptions) ([]string, error) {
+	c.calls++
+	path := filepath.Join(c.dir, "image.png")
+	err := os.WriteFile(path, []byte(prompt), 0o644)
+	return []string{"file://" + path}, err
+}
+
+func TestCachedProviders(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+	store, err := NewDiskCacheStore(filepath.Join(CacheDir(), "entries"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := &scriptedText{answers: []string{"a story", "another story"}}
+	images := &countingImages{dir: t.TempDir()}
+	providers, recorder := WithCache(&Providers{Text: text, Images: images}, cache)
+
+	for i := 0; i < 2; i++ {
+		answer, err := providers.Text.GetCompletition(context.Background(), "robots", "")
+		if err != nil || answer != "a story" {
+			t.Fatalf("expected the first answer every time, got %q, %v", answer, err)
+		}
+	}
+	if other, _ := providers.Text.GetCompletition(context.Background(), "robots", "be brief"); other != "another story" {
+		t.Fatalf("expected a different system prompt to miss, got %q", other)
+	}
+
+	first, err := providers.Images.GetImages(context.Background(), "a lamp", 1, ImageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := providers.Images.GetImages(context.Background(), "a lamp", 1, ImageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images.calls != 1 || !strings.HasPrefix(second[0], "file://"+cache.FilesDir) || first[0] == second[0] {
+		t.Fatalf("expected the second image to come from the cache, got %d calls and %q", images.calls, second)
+	}
+	if data, _ := os.ReadFile(strings.TrimPrefix(second[0], "file://")); string(data) != "a lamp" {
+		t.Fatalf("expected the cached image to keep its content, got %q", data)
+	}
+
+	stats := recorder.Stats()
+	if stats["text"].Hits != 1 || stats["text"].Misses != 2 || stats["images"].Hits != 1 || stats["images"].Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	store, err := NewDiskCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &Cache{Store: store, TTL: time.Hour, MaxBytes: 10}
+	ctx := context.Background()
+
+	for _, key := range []string{"text/old", "text/older", "text/new"} {
+		if err := store.Put(ctx, key, []byte("12345")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chtimes(store.path("text/older"), time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour))
+	os.Chtimes(store.path("text/old"), time.Now().Add(-time.Minute), time.Now().Add(-time.Minute))
+
+	if _, err := cache.Get(ctx, "text/older"); err != ErrCacheMiss {
+		t.Fatalf("expected an expired entry to miss, got %v", err)
+	}
+
+	store.Put(ctx, "text/newest", []byte("12345"))
+	if err := cache.Evict(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := store.List(ctx)
+	if len(entries) != 2 {
+		t.Fatalf("expected the oldest entry to be evicted to fit 10 bytes, got %+v", entries)
+	}
+	if _, err := cache.Get(ctx, "text/old"); err != ErrCacheMiss {
+		t.Fatalf("expected text/old to be evicted, got %v", err)
+	}
+}
+
+func TestCacheOnlyKeepsValidatedAnswers(t *testing.T) {
+	store, err := NewDiskCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &Cache{Store: store, TTL: time.Hour}
+
+	valid := `{"art_style": "ink", "palette": "black"}`
+	text := &scriptedText{answers: []string{"not json", valid}}
+	providers, _ := WithCache(&Providers{Text: text}, cache)
+	if _, err := GenerateStyleBible(context.Background(), providers.Text, "A story.", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a retry of the job asks the same question, the rejected answer must not come back
+	retry := &scriptedText{}
+	providers, recorder := WithCache(&Providers{Text: retry}, cache)
+	bible, err := GenerateStyleBible(context.Background(), providers.Text, "A story.", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bible.ArtStyle != "ink" || len(retry.prompts) != 0 || recorder.Stats()["text"].Hits != 1 {
+		t.Fatalf("expected the accepted answer to be cached for the first prompt, got %+v after %d calls", bible, len(retry.prompts))
+	}
+}
+
+func TestCacheFilesCountTowardsMaxBytes(t *testing.T) {
+	store, err := NewDiskCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &Cache{Store: store, TTL: 24 * time.Hour, MaxBytes: 10, FilesDir: t.TempDir()}
+	ctx := context.Background()
+
+	store.Put(ctx, "text/entry", []byte("12345"))
+	for name, age := range map[string]time.Duration{"oldest.wav": 3 * time.Hour, "old.wav": 2 * time.Hour, "in-use.wav": time.Minute} {
+		path := filepath.Join(cache.FilesDir, name)
+		os.WriteFile(path, []byte("12345"), 0o644)
+		os.Chtimes(path, time.Now().Add(-age), time.Now().Add(-age))
+	}
+
+	if err := cache.Evict(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := os.ReadDir(cache.FilesDir)
+	if len(files) != 1 || files[0].Name() != "in-use.wav" {
+		t.Fatalf("expected only the recently used file to be kept, got %v", files)
+	}
+}
+
+// countingSpeech answers with a new URL on every call
+type countingSpeech struct {
+	calls int
+	dir   string
+}
+
+func (c *countingSpeech) GetVoice(ctx context.Context, text string, options VoiceOptions) (string, error) {
+	c.calls++
+	path := filepath.Join(c.dir, fmt.Sprintf("voice_%d.wav", c.calls))
+	return "file://" + path, os.WriteFile(path, []byte(text), 0o644)
+}
+
+func TestCachedSpeechKeysOnSampleContent(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+	store, err := NewDiskCacheStore(filepath.Join(CacheDir(), "entries"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	speech := &countingSpeech{dir: t.TempDir()}
+	providers, _ := WithCache(&Providers{Speech: speech}, cache)
+
+	// the same uploaded voice, copied into the work directories of two jobs
+	for _, dir := range []string{t.TempDir(), t.TempDir()} {
+		sample := filepath.Join(dir, "voice_sample.wav")
+		os.WriteFile(sample, []byte("RIFF sample"), 0o644)
+		if _, err := providers.Speech.GetVoice(context.Background(), "Hello.", VoiceOptions{Speaker: "file://" + sample}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if speech.calls != 1 {
+		t.Fatalf("expected the second job to hit the cache, got %d calls", speech.calls)
+	}
+}
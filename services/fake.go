@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+	"github.com/thedekerone/shorts-maker/pkg"
+)
+
+// FakeScript is the story every FakeProvider completion without a system prompt returns
+const FakeScript = "A small robot woke up in an empty library. It read every book in one night. By morning, it knew how to dream. Then it opened the door and walked into the sun."
+
+const (
+	fakeSampleRate   = 16000
+	fakeWordDuration = 0.4
+	fakeLeadOut      = 0.5
+)
+
+// FakeProvider implements every provider interface without touching the network,
+// media is written to Dir and returned as file:// URLs
+type FakeProvider struct {
+	Dir string
+}
+
+func NewFakeProvider() (*FakeProvider, error) {
+	dir := envOrDefault("FAKE_PROVIDER_DIR", filepath.Join(os.TempDir(), "shorts-maker-fake"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FakeProvider{Dir: dir}, nil
+}
+
+// FakeVoiceDuration is the length in seconds of the audio FakeProvider synthesizes for text
+func FakeVoiceDuration(text string) float64 {
+	return float64(len(strings.Fields(text)))*fakeWordDuration + fakeLeadOut
+}
+
+func (f *FakeProvider) GetCompletition(ctx context.Context, prompt string, systemPrompt string) (string, error) {
+	if systemPrompt == "" {
+		return FakeScript, nil
+	}
+
+	// wrapped the way real models like to answer, so the repair path is exercised
+	if systemPrompt == StructuredScriptSystemPrompt {
+		story, err := json.MarshalIndent(fakeStory(), "", "  ")
+		return "Here is your story:\n```json\n" + string(story) + "\n```", err
+	}
+
+	if systemPrompt == StyleBibleSystemPrompt {
+		return `{
+  "art_style": "flat vector illustration with soft shadows",
+  "palette": "warm browns and teal",
+  "setting": "a dusty library at night",
+  "characters": [{"name": "Robot", "description": "a small round silver robot with one blue eye"},],
+}`, nil
+	}
+
+	words := strings.Fields(prompt)
+	if len(words) > 12 {
+		words = words[len(words)-12:]
+	}
+	return "A flat illustration of " + strings.Join(words, " "), nil
+}
+
+// fakeStory splits FakeScript into one scene per sentence
+func fakeStory() models.PredictionOutputFormat {
+	story := models.PredictionOutputFormat{
+		Title:       "The Robot Who Learned to Dream",
+		Hook:        "A small robot woke up in an empty library.",
+		Script:      FakeScript,
+		Hashtags:    []string{"#robots", "#story"},
+		Description: "A robot reads every book and finds something new.",
+	}
+	for _, sentence := range pkg.SplitSentences(FakeScript, pkg.MaxSpeechChunk) {
+		story.Scenes = append(story.Scenes, models.Scene{Text: sentence, Visual: "A flat illustration of " + sentence})
+	}
+	return story
+}
+
+// GetVoice writes a sine wave lasting FakeVoiceDuration(text)
+func (f *FakeProvider) GetVoice(ctx context.Context, text string, options VoiceOptions) (string, error) {
+	path := filepath.Join(f.Dir, "voice_"+contentHash(text, options.Speaker, options.Language)+".wav")
+
+	samples := int(FakeVoiceDuration(text) * fakeSampleRate)
+	pcm := make([]byte, samples*2)
+	for i := 0; i < samples; i++ {
+		value := int16(0.3 * math.MaxInt16 * math.Sin(2*math.Pi*440*float64(i)/fakeSampleRate))
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(value))
+	}
+
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+len(pcm)))
+	wav.WriteString("WAVEfmt ")
+	binary.Write(&wav, binary.LittleEndian, uint32(16))
+	binary.Write(&wav, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&wav, binary.LittleEndian, uint16(1)) // mono
+	binary.Write(&wav, binary.LittleEndian, uint32(fakeSampleRate))
+	binary.Write(&wav, binary.LittleEndian, uint32(fakeSampleRate*2))
+	binary.Write(&wav, binary.LittleEndian, uint16(2))
+	binary.Write(&wav, binary.LittleEndian, uint16(16))
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(len(pcm)))
+	wav.Write(pcm)
+
+	if err := os.WriteFile(path, wav.Bytes(), 0o644); err != nil {
+		return "", err
+	}
+
+	return "file://" + path, nil
+}
+
+// GetTranscription spreads the words of initial evenly over the audio, one segment per sentence
+func (f *FakeProvider) GetTranscription(ctx context.Context, audio string, initial string, language string) (*models.TranscriptionOutput, error) {
+	file, err := os.Open(strings.TrimPrefix(audio, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := pkg.ReadWavInfo(file)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(initial)
+	if len(words) == 0 {
+		return nil, errors.New("nothing to transcribe")
+	}
+
+	slot := (info.Duration - fakeLeadOut) / float64(len(words))
+
+	if language == "" {
+		language = "en"
+	}
+
+	output := &models.TranscriptionOutput{Language: language}
+	var segment models.Segment
+
+	for i, word := range words {
+		start := float64(i) * slot
+		w := models.Word{Start: start, End: start + slot*0.8, Word: word, Score: 1}
+
+		if len(segment.Words) == 0 {
+			segment.Start = w.Start
+		}
+		segment.Words = append(segment.Words, w)
+
+		if strings.ContainsAny(word[len(word)-1:], ".!?") || i == len(words)-1 {
+			segment.End = w.End
+			texts := make([]string, len(segment.Words))
+			for j, sw := range segment.Words {
+				texts[j] = sw.Word
+			}
+			segment.Text = strings.Join(texts, " ")
+			output.Segments = append(output.Segments, segment)
+			segment = models.Segment{}
+		}
+	}
+
+	return output, nil
+}
+
+// GetImages writes solid color PNGs in the requested aspect ratio, the color is derived from the prompt
+func (f *FakeProvider) GetImages(ctx context.Context, prompt string, quantity int64, options ImageOptions) ([]string, error) {
+	var urls []string
+
+	// the longest side is 512 pixels, 9:16 when the aspect ratio is missing or invalid
+	width, height := 9, 16
+	fmt.Sscanf(options.AspectRatio, "%d:%d", &width, &height)
+	if width <= 0 || height <= 0 {
+		width, height = 9, 16
+	}
+	scale := 512 / float64(max(width, height))
+	width, height = int(float64(width)*scale), int(float64(height)*scale)
+
+	// a fixed seed changes the color like it changes the image of a real model
+	seed := ""
+	if options.Seed != nil {
+		seed = strconv.FormatInt(*options.Seed, 10)
+	}
+
+	for i := int64(0); i < quantity; i++ {
+		hash := fnv.New32a()
+		fmt.Fprintf(hash, "%s/%d/%s", prompt, i, seed)
+		sum := hash.Sum32()
+		fill := color.RGBA{R: uint8(sum), G: uint8(sum >> 8), B: uint8(sum >> 16), A: 255}
+
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = fill.R, fill.G, fill.B, fill.A
+		}
+
+		path := filepath.Join(f.Dir, fmt.Sprintf("image_%s_%d.png", contentHash(prompt, options.AspectRatio, seed), i))
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = png.Encode(file, img)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, "file://"+path)
+	}
+
+	return urls, nil
+}
+
+func contentHash(parts ...string) string {
+	hash := sha1.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type JobStore interface {
+	Create(job *models.Job) error
+	Get(id string) (*models.Job, error)
+	// Update applies fn to the stored job and persists the result
+	Update(id string, fn func(job *models.Job)) (*models.Job, error)
+	List() ([]*models.Job, error)
+}
+
+// FileJobStore keeps every job as a JSON file inside dir and serves reads
+// from an in-memory copy loaded at startup
+type FileJobStore struct {
+	dir  string
+	mu   sync.RWMutex
+	jobs map[string]*models.Job
+}
+
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+
+	store := &FileJobStore{
+		dir:  dir,
+		jobs: make(map[string]*models.Job),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job %s: %w", entry.Name(), err)
+		}
+
+		var job models.Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode job %s: %w", entry.Name(), err)
+		}
+
+		store.jobs[job.ID] = &job
+	}
+
+	return store, nil
+}
+
+func (s *FileJobStore) Create(job *models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+
+	stored := job.Copy()
+	if err := s.write(stored); err != nil {
+		return err
+	}
+
+	s.jobs[job.ID] = stored
+	return nil
+}
+
+func (s *FileJobStore) Get(id string) (*models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	return job.Copy(), nil
+}
+
+func (s *FileJobStore) Update(id string, fn func(job *models.Job)) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	updated := job.Copy()
+	fn(updated)
+
+	if err := s.write(updated); err != nil {
+		return nil, err
+	}
+
+	s.jobs[id] = updated
+	return updated.Copy(), nil
+}
+
+// List returns every stored job, newest first
+func (s *FileJobStore) List() ([]*models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*models.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.Copy())
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs, nil
+}
+
+// write replaces the job file atomically so a crash never leaves half a job on disk
+func (s *FileJobStore) write(job *models.Job) error {
+	if job.ID == "" || strings.ContainsAny(job.ID, `/\`) {
+		return fmt.Errorf("invalid job id %q", job.ID)
+	}
+
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, job.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create job file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, job.ID+".json"))
+}
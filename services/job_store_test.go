@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+func TestFileJobStoreSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	err = store.Create(&models.Job{
+		ID:        "job-1",
+		Status:    "initialized",
+		Spec:      models.RenderSpec{Prompt: "a story about a cat"},
+		History:   []models.JobStage{{Status: "initialized", At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+
+	_, err = store.Update("job-1", func(job *models.Job) {
+		job.Status = "generating_voice"
+		job.History = append(job.History, models.JobStage{Status: "generating_voice", At: now})
+	})
+	if err != nil {
+		t.Fatalf("failed to update job: %v", err)
+	}
+
+	reopened, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+
+	job, err := reopened.Get("job-1")
+	if err != nil {
+		t.Fatalf("job was not persisted: %v", err)
+	}
+
+	if job.Status != "generating_voice" || job.Spec.Prompt != "a story about a cat" {
+		t.Fatalf("unexpected job after reopen: %+v", job)
+	}
+
+	if len(job.History) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(job.History))
+	}
+
+	if _, err := reopened.Get("missing"); err != ErrJobNotFound {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
@@ -1,8 +1,13 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -39,3 +44,83 @@ func ConnectToMinio() (*MinioService, error) {
 
 	return NewMinioService(minioClient), nil
 }
+
+func (ms *MinioService) PutFile(ctx context.Context, key, path, contentType string) error {
+	_, err := ms.Client.FPutObject(ctx, Bucket, key, path, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (ms *MinioService) PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	object, err := ms.Client.PresignedGetObject(ctx, Bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return object.String(), nil
+}
+
+func (ms *MinioService) GetFile(ctx context.Context, key, path string) error {
+	return ms.Client.FGetObject(ctx, Bucket, key, path, minio.GetObjectOptions{})
+}
+
+func (ms *MinioService) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := ms.Client.StatObject(ctx, Bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MinioCacheStore keeps cache entries as objects under Prefix in the bucket
+type MinioCacheStore struct {
+	Client *minio.Client
+	Prefix string
+}
+
+func NewMinioCacheStore(client *minio.Client) *MinioCacheStore {
+	return &MinioCacheStore{Client: client, Prefix: "cache/"}
+}
+
+func (s *MinioCacheStore) Get(ctx context.Context, key string) ([]byte, time.Time, error) {
+	object, err := s.Client.GetObject(ctx, Bucket, s.Prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err := io.ReadAll(object)
+	return data, info.LastModified, err
+}
+
+func (s *MinioCacheStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.Client.PutObject(ctx, Bucket, s.Prefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	return err
+}
+
+func (s *MinioCacheStore) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, Bucket, s.Prefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *MinioCacheStore) List(ctx context.Context) ([]CacheEntry, error) {
+	var entries []CacheEntry
+
+	for object := range s.Client.ListObjects(ctx, Bucket, minio.ListObjectsOptions{Prefix: s.Prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		entries = append(entries, CacheEntry{
+			Key:     strings.TrimPrefix(object.Key, s.Prefix),
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CustomMusicPrefix marks a track that was uploaded through POST /replicate/music
+const CustomMusicPrefix = "custom:"
+
+// MusicTrack is a background track of the local music library
+type MusicTrack struct {
+	Name string `json:"name"`
+	// File is relative to the library directory
+	File        string   `json:"file"`
+	Moods       []string `json:"moods"`
+	Description string   `json:"description,omitempty"`
+}
+
+// MusicLibrary is the list of tracks jobs can pick by name or mood
+type MusicLibrary struct {
+	Dir    string
+	Tracks []MusicTrack
+}
+
+// LoadMusicLibrary reads the library.json array of tracks in dir, see assets/music/README.md
+// for its format. The library is empty out of the box since we don't ship any music
+func LoadMusicLibrary(dir string) (*MusicLibrary, error) {
+	path := filepath.Join(dir, "library.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []MusicTrack
+	if err := json.Unmarshal(data, &tracks); err != nil {
+		return nil, fmt.Errorf("invalid music library %s: %w", path, err)
+	}
+
+	for i, track := range tracks {
+		if track.Name == "" || track.File == "" {
+			return nil, fmt.Errorf("track %d of %s needs a name and a file", i, path)
+		}
+		if strings.HasPrefix(track.Name, CustomMusicPrefix) {
+			return nil, fmt.Errorf("track name %s uses the reserved %q prefix", track.Name, CustomMusicPrefix)
+		}
+		if _, err := os.Stat(filepath.Join(dir, track.File)); err != nil {
+			return nil, fmt.Errorf("track %s: %w", track.Name, err)
+		}
+	}
+
+	return &MusicLibrary{Dir: dir, Tracks: tracks}, nil
+}
+
+// Get looks a track up by name
+func (l *MusicLibrary) Get(name string) (MusicTrack, bool) {
+	for _, track := range l.Tracks {
+		if track.Name == name {
+			return track, true
+		}
+	}
+	return MusicTrack{}, false
+}
+
+// Pick chooses one of the tracks tagged with mood, the same seed always gets the same track
+// so a retried job keeps its music
+func (l *MusicLibrary) Pick(mood, seed string) (MusicTrack, bool) {
+	matches := l.WithMood(mood)
+	if len(matches) == 0 {
+		return MusicTrack{}, false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	return matches[h.Sum32()%uint32(len(matches))], true
+}
+
+// Moods lists every mood tag of the library once
+func (l *MusicLibrary) Moods() []string {
+	seen := make(map[string]bool)
+	moods := []string{}
+	for _, track := range l.Tracks {
+		for _, tag := range track.Moods {
+			tag = strings.ToLower(tag)
+			if !seen[tag] {
+				seen[tag] = true
+				moods = append(moods, tag)
+			}
+		}
+	}
+	return moods
+}
+
+// WithMood returns the tracks tagged with mood
+func (l *MusicLibrary) WithMood(mood string) []MusicTrack {
+	matches := []MusicTrack{}
+	for _, track := range l.Tracks {
+		for _, tag := range track.Moods {
+			if strings.EqualFold(tag, mood) {
+				matches = append(matches, track)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// Path is where the audio of a library track is on disk
+func (l *MusicLibrary) Path(track MusicTrack) string {
+	return filepath.Join(l.Dir, track.File)
+}
+
+// CustomMusicKey is the object name an uploaded music track is stored under
+func CustomMusicKey(id string) string {
+	return "music/" + id
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMusicLibraryPick(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"calm.mp3", "calm2.mp3", "epic.mp3"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0o644)
+	}
+	os.WriteFile(filepath.Join(dir, "library.json"), []byte(`[
+		{"name": "calm", "file": "calm.mp3", "moods": ["Calm", "sad"]},
+		{"name": "calm2", "file": "calm2.mp3", "moods": ["calm"]},
+		{"name": "epic", "file": "epic.mp3", "moods": ["epic"]}
+	]`), 0o644)
+
+	library, err := LoadMusicLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if moods := library.Moods(); len(moods) != 3 {
+		t.Fatalf("expected calm, sad and epic, got %v", moods)
+	}
+
+	track, ok := library.Pick("calm", "job-1")
+	if !ok || (track.Name != "calm" && track.Name != "calm2") {
+		t.Fatalf("expected a calm track, got %+v", track)
+	}
+	if again, _ := library.Pick("calm", "job-1"); again.Name != track.Name {
+		t.Fatal("expected the same seed to pick the same track")
+	}
+
+	if _, ok := library.Pick("happy", "job-1"); ok {
+		t.Fatal("expected no track for an unknown mood")
+	}
+
+	os.Remove(filepath.Join(dir, "epic.mp3"))
+	if _, err := LoadMusicLibrary(dir); err == nil {
+		t.Fatal("expected a missing track file to fail")
+	}
+}
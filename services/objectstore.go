@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const Bucket = "shorts-maker"
+
+// ObjectStore is where rendered shorts and other job outputs are published
+type ObjectStore interface {
+	PutFile(ctx context.Context, key, path, contentType string) error
+	PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	GetFile(ctx context.Context, key, path string) error
+}
+
+type storedObject struct {
+	Data        []byte
+	ContentType string
+}
+
+// MemoryObjectStore keeps objects in memory, it stands in for MinIO in tests and offline runs
+type MemoryObjectStore struct {
+	mu      sync.RWMutex
+	objects map[string]storedObject
+}
+
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: make(map[string]storedObject)}
+}
+
+func (s *MemoryObjectStore) PutFile(ctx context.Context, key, path, contentType string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = storedObject{Data: data, ContentType: contentType}
+	return nil
+}
+
+func (s *MemoryObjectStore) PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.objects[key]; !ok {
+		return "", fmt.Errorf("object %s not found", key)
+	}
+
+	return fmt.Sprintf("http://memory/%s/%s", Bucket, key), nil
+}
+
+func (s *MemoryObjectStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+func (s *MemoryObjectStore) GetFile(ctx context.Context, key, path string) error {
+	data, _, ok := s.Get(key)
+	if !ok {
+		return fmt.Errorf("object %s not found", key)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Get returns the content of a stored object
+func (s *MemoryObjectStore) Get(key string) ([]byte, string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	object, ok := s.objects[key]
+	return object.Data, object.ContentType, ok
+}
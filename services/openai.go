@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// OpenAITextGenerator talks to any OpenAI compatible chat completions endpoint,
+// which covers OpenAI itself as well as local servers like Ollama or vLLM
+type OpenAITextGenerator struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+// NewOpenAITextGenerator is configured through OPENAI_BASE_URL, OPENAI_API_KEY and OPENAI_MODEL
+func NewOpenAITextGenerator() (*OpenAITextGenerator, error) {
+	baseURL := envOrDefault("OPENAI_BASE_URL", "https://api.openai.com/v1")
+	apiKey := os.Getenv("OPENAI_API_KEY")
+
+	if apiKey == "" && strings.Contains(baseURL, "api.openai.com") {
+		return nil, errors.New("OPENAI_API_KEY is required")
+	}
+
+	return &OpenAITextGenerator{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+		Model:   envOrDefault("OPENAI_MODEL", "gpt-4o-mini"),
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// ModelID is the endpoint and model, it keys the cache
+func (g *OpenAITextGenerator) ModelID(capability string) string {
+	return "openai/" + g.BaseURL + "/" + g.Model
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model     string        `json:"model"`
+	Messages  []chatMessage `json:"messages"`
+	MaxTokens int           `json:"max_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (g *OpenAITextGenerator) GetCompletition(ctx context.Context, prompt string, systemPrompt string) (string, error) {
+	if systemPrompt == "" {
+		systemPrompt = DefaultStorySystemPrompt
+	}
+
+	body, err := json.Marshal(chatCompletionRequest{
+		Model: g.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: 2000,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, g.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if g.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+g.APIKey)
+	}
+
+	response, err := g.Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var completion chatCompletionResponse
+	if err := json.NewDecoder(response.Body).Decode(&completion); err != nil {
+		return "", fmt.Errorf("failed to decode completion: %w", err)
+	}
+
+	if completion.Error != nil {
+		return "", errors.New(completion.Error.Message)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("completion request failed: %s", response.Status)
+	}
+
+	if len(completion.Choices) == 0 {
+		return "", errors.New("output is nil")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
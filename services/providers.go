@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// DefaultStorySystemPrompt is used by text generators when no system prompt is given
+const DefaultStorySystemPrompt = `
+    You are a creative storytelling AI designed to generate engaging, you create stories on the same language as the input, short-form stories suitable for TikTok's text-to-speech feature. Your task is to create captivating stories based on simple text prompts.
+    Guidelines:
+
+    Generate a story based on the given text prompt.
+    Keep the story concise, aiming for 60-120 seconds when read aloud.
+    Use vivid, descriptive language to engage the listener.
+    Ensure the story has a clear beginning, middle, and end.
+    Incorporate elements of surprise, humor, or emotional appeal when appropriate.
+    Use simple language and short sentences for easy listening.
+    Avoid explicit content, excessive violence, or controversial topics.
+    End with a hook or twist to encourage engagement.
+    The story can be either real (based on historical events or facts) or fictional, depending on the prompt.
+    Adapt your storytelling style to best fit the prompt.
+
+    Input:
+    [Text prompt]
+    Output:
+    [Generated story text only]
+    Remember to generate only the story text, without any additional elements like titles or hashtags. Create a story that would be engaging and suitable for TikTok's audience.
+    `
+
+// VoiceOptions picks who speaks and in which language, empty fields use the model defaults
+type VoiceOptions struct {
+	Speaker  string
+	Language string
+}
+
+type TextGenerator interface {
+	GetCompletition(ctx context.Context, prompt string, systemPrompt string) (string, error)
+}
+
+// SpeechSynthesizer turns text into speech and returns the URL of the audio
+type SpeechSynthesizer interface {
+	GetVoice(ctx context.Context, text string, options VoiceOptions) (string, error)
+}
+
+// Transcriber returns the segments and word timings spoken in an audio URL
+type Transcriber interface {
+	GetTranscription(ctx context.Context, audio string, initial string, language string) (*models.TranscriptionOutput, error)
+}
+
+// ImageOptions shape the generated images, empty fields use the model defaults
+type ImageOptions struct {
+	// AspectRatio is width:height, like 9:16
+	AspectRatio string
+	// Seed makes the model draw the same image for the same prompt, nil means random
+	Seed *int64
+}
+
+// ImageGenerator returns the URLs of quantity images generated from prompt
+type ImageGenerator interface {
+	GetImages(ctx context.Context, prompt string, quantity int64, options ImageOptions) ([]string, error)
+}
+
+var (
+	_ TextGenerator     = (*ReplicateService)(nil)
+	_ SpeechSynthesizer = (*ReplicateService)(nil)
+	_ Transcriber       = (*ReplicateService)(nil)
+	_ ImageGenerator    = (*ReplicateService)(nil)
+	_ TextGenerator     = (*OpenAITextGenerator)(nil)
+	_ TextGenerator     = (*FakeProvider)(nil)
+	_ SpeechSynthesizer = (*FakeProvider)(nil)
+	_ Transcriber       = (*FakeProvider)(nil)
+	_ ImageGenerator    = (*FakeProvider)(nil)
+)
+
+// Providers is the set of implementations a job is rendered with
+type Providers struct {
+	Text        TextGenerator
+	Speech      SpeechSynthesizer
+	Transcriber Transcriber
+	Images      ImageGenerator
+}
+
+// fakeProvider is only available with ENABLE_FAKE_PROVIDERS=1, so API callers can't
+// render jobs with it in production
+const fakeProvider = "fake"
+
+func fakeProvidersEnabled() bool {
+	return os.Getenv("ENABLE_FAKE_PROVIDERS") == "1"
+}
+
+type registry[T any] map[string]func() (T, error)
+
+func (r registry[T]) names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		if name == fakeProvider && !fakeProvidersEnabled() {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r registry[T]) create(capability, name string) (T, error) {
+	factory, ok := r[name]
+	if !ok || (name == fakeProvider && !fakeProvidersEnabled()) {
+		var zero T
+		return zero, fmt.Errorf("unknown %s provider %q", capability, name)
+	}
+	return factory()
+}
+
+var (
+	textGenerators = registry[TextGenerator]{
+		"replicate": func() (TextGenerator, error) { return NewReplicateService() },
+		"openai":    func() (TextGenerator, error) { return NewOpenAITextGenerator() },
+		"fake":      func() (TextGenerator, error) { return NewFakeProvider() },
+	}
+	speechSynthesizers = registry[SpeechSynthesizer]{
+		"replicate": func() (SpeechSynthesizer, error) { return NewReplicateService() },
+		"fake":      func() (SpeechSynthesizer, error) { return NewFakeProvider() },
+	}
+	transcribers = registry[Transcriber]{
+		"replicate": func() (Transcriber, error) { return NewReplicateService() },
+		"fake":      func() (Transcriber, error) { return NewFakeProvider() },
+	}
+	imageGenerators = registry[ImageGenerator]{
+		"replicate": func() (ImageGenerator, error) { return NewReplicateService() },
+		"fake":      func() (ImageGenerator, error) { return NewFakeProvider() },
+	}
+)
+
+func RegisterTextGenerator(name string, factory func() (TextGenerator, error)) {
+	textGenerators[name] = factory
+}
+
+func RegisterSpeechSynthesizer(name string, factory func() (SpeechSynthesizer, error)) {
+	speechSynthesizers[name] = factory
+}
+
+func RegisterTranscriber(name string, factory func() (Transcriber, error)) {
+	transcribers[name] = factory
+}
+
+func RegisterImageGenerator(name string, factory func() (ImageGenerator, error)) {
+	imageGenerators[name] = factory
+}
+
+// DefaultProviders returns the provider names configured through TEXT_PROVIDER,
+// SPEECH_PROVIDER, TRANSCRIPTION_PROVIDER and IMAGE_PROVIDER, falling back to replicate
+func DefaultProviders() models.ProviderSelection {
+	return models.ProviderSelection{
+		Text:          envOrDefault("TEXT_PROVIDER", "replicate"),
+		Speech:        envOrDefault("SPEECH_PROVIDER", "replicate"),
+		Transcription: envOrDefault("TRANSCRIPTION_PROVIDER", "replicate"),
+		Images:        envOrDefault("IMAGE_PROVIDER", "replicate"),
+	}
+}
+
+// ValidateProviders returns a message per selected provider that isn't registered
+func ValidateProviders(selection models.ProviderSelection) map[string]string {
+	errs := make(map[string]string)
+
+	check := func(field, name string, names []string) {
+		if name == "" {
+			return
+		}
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		errs["providers."+field] = "must be one of: " + strings.Join(names, ", ")
+	}
+
+	check("text", selection.Text, textGenerators.names())
+	check("speech", selection.Speech, speechSynthesizers.names())
+	check("transcription", selection.Transcription, transcribers.names())
+	check("images", selection.Images, imageGenerators.names())
+
+	return errs
+}
+
+// NewProviders creates the selected providers, empty names use the configured defaults
+func NewProviders(selection models.ProviderSelection) (*Providers, error) {
+	defaults := DefaultProviders()
+	if selection.Text == "" {
+		selection.Text = defaults.Text
+	}
+	if selection.Speech == "" {
+		selection.Speech = defaults.Speech
+	}
+	if selection.Transcription == "" {
+		selection.Transcription = defaults.Transcription
+	}
+	if selection.Images == "" {
+		selection.Images = defaults.Images
+	}
+
+	text, err := textGenerators.create("text", selection.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	speech, err := speechSynthesizers.create("speech", selection.Speech)
+	if err != nil {
+		return nil, err
+	}
+
+	transcriber, err := transcribers.create("transcription", selection.Transcription)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := imageGenerators.create("images", selection.Images)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Providers{
+		Text:        text,
+		Speech:      speech,
+		Transcriber: transcriber,
+		Images:      images,
+	}, nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+func TestFakeProvidersNeedFlag(t *testing.T) {
+	t.Setenv("FAKE_PROVIDER_DIR", t.TempDir())
+	fake := models.ProviderSelection{Text: "fake", Speech: "fake", Transcription: "fake", Images: "fake"}
+
+	t.Setenv("ENABLE_FAKE_PROVIDERS", "")
+	if errs := ValidateProviders(fake); len(errs) != 4 {
+		t.Fatalf("expected every fake provider to be rejected, got %v", errs)
+	}
+	if _, err := NewProviders(fake); err == nil {
+		t.Fatal("expected the fake providers not to be created")
+	}
+
+	t.Setenv("ENABLE_FAKE_PROVIDERS", "1")
+	if errs := ValidateProviders(fake); len(errs) != 0 {
+		t.Fatalf("expected the fake providers to be accepted, got %v", errs)
+	}
+	if _, err := NewProviders(fake); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrQueueFull = errors.New("job queue is full")
+
+// Priority lanes, drained in this order; jobs inside a lane are FIFO
+var Priorities = []string{"high", "normal", "low"}
+
+const DefaultPriority = "normal"
+
+func ValidPriority(priority string) bool {
+	for _, p := range Priorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// JobQueue runs queued job IDs on a fixed number of workers
+type JobQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	lanes    map[string][]string
+	maxDepth int
+	run      func(jobID string)
+}
+
+func NewJobQueue(workers, maxDepth int, run func(jobID string)) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q := &JobQueue{
+		lanes:    make(map[string][]string),
+		maxDepth: maxDepth,
+		run:      run,
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+func (q *JobQueue) Enqueue(jobID, priority string) error {
+	if !ValidPriority(priority) {
+		priority = DefaultPriority
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxDepth > 0 && q.len() >= q.maxDepth {
+		return ErrQueueFull
+	}
+
+	q.lanes[priority] = append(q.lanes[priority], jobID)
+	q.cond.Signal()
+	return nil
+}
+
+// Position returns the 1-based place of jobID in the queue, or 0 if it isn't waiting
+func (q *JobQueue) Position(jobID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	position := 0
+	for _, priority := range Priorities {
+		for _, id := range q.lanes[priority] {
+			position++
+			if id == jobID {
+				return position
+			}
+		}
+	}
+
+	return 0
+}
+
+// Remove takes jobID out of the queue, it reports false if the job wasn't waiting
+func (q *JobQueue) Remove(jobID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for priority, lane := range q.lanes {
+		for i, id := range lane {
+			if id == jobID {
+				q.lanes[priority] = append(lane[:i:i], lane[i+1:]...)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (q *JobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.len()
+}
+
+func (q *JobQueue) len() int {
+	total := 0
+	for _, lane := range q.lanes {
+		total += len(lane)
+	}
+	return total
+}
+
+func (q *JobQueue) work() {
+	for {
+		q.run(q.next())
+	}
+}
+
+func (q *JobQueue) next() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for _, priority := range Priorities {
+			if lane := q.lanes[priority]; len(lane) > 0 {
+				q.lanes[priority] = lane[1:]
+				return lane[0]
+			}
+		}
+		q.cond.Wait()
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobQueuePriorityAndDepth(t *testing.T) {
+	started := make(chan string, 4)
+	release := make(chan struct{})
+
+	q := NewJobQueue(1, 2, func(jobID string) {
+		started <- jobID
+		<-release
+	})
+
+	if err := q.Enqueue("first", "normal"); err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+
+	select {
+	case id := <-started:
+		if id != "first" {
+			t.Fatalf("expected first job to start, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("worker never picked up the job")
+	}
+
+	q.Enqueue("normal", "normal")
+	q.Enqueue("urgent", "high")
+
+	if pos := q.Position("urgent"); pos != 1 {
+		t.Fatalf("expected high priority job at position 1, got %d", pos)
+	}
+
+	if pos := q.Position("normal"); pos != 2 {
+		t.Fatalf("expected normal job at position 2, got %d", pos)
+	}
+
+	if err := q.Enqueue("overflow", "low"); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	release <- struct{}{}
+
+	if id := <-started; id != "urgent" {
+		t.Fatalf("expected high priority job to run next, got %s", id)
+	}
+
+	close(release)
+}
@@ -4,50 +4,81 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"os"
 	"strings"
 
 	"github.com/replicate/replicate-go"
 	"github.com/thedekerone/shorts-maker/models"
 )
 
+const defaultSpeaker = "https://replicate.delivery/pbxt/KMZ6fyOMKrtwERmDWAJnd5KRy39a86dgloX7SYP5dVTnQXjv/jacob.wav"
+
+// ReplicateModels are the model identifiers used for each capability, a version
+// suffix pins the model, without one the latest version is used
+type ReplicateModels struct {
+	Text          string
+	Speech        string
+	Transcription string
+	Images        string
+}
+
+var DefaultReplicateModels = ReplicateModels{
+	Text:          "meta/meta-llama-3-70b-instruct:fbfb20b472b2f3bdd101412a9f70a0ed4fc0ced78a77ff00970ee7a2383c575d",
+	Speech:        "lucataco/xtts-v2:49ff6cfa14bd4e7f80f62e2279f82f23dfc2e7970f825f8db5599f8a6213c009",
+	Transcription: "victor-upmeet/whisperx:84d2ad2d6194fe98a17d2b60bef1c7f910c46b2f6fd38996ca457afd9c8abfcb",
+	Images:        "black-forest-labs/flux-schnell",
+}
+
+// ReplicateService implements every provider interface on top of Replicate models
 type ReplicateService struct {
 	Client *replicate.Client
+	Models ReplicateModels
 }
 
+// NewReplicateService reads the token from REPLICATE_API_TOKEN, the REPLICATE_*_MODEL
+// variables override the default model of each capability
 func NewReplicateService() (*ReplicateService, error) {
 	client, err := replicate.NewClient(replicate.WithTokenFromEnv())
 	if err != nil {
 		return nil, err
 	}
-	return &ReplicateService{Client: client}, nil
+
+	models := DefaultReplicateModels
+	overrideFromEnv(&models.Text, "REPLICATE_TEXT_MODEL")
+	overrideFromEnv(&models.Speech, "REPLICATE_SPEECH_MODEL")
+	overrideFromEnv(&models.Transcription, "REPLICATE_TRANSCRIPTION_MODEL")
+	overrideFromEnv(&models.Images, "REPLICATE_IMAGE_MODEL")
+
+	return &ReplicateService{Client: client, Models: models}, nil
 }
 
-func (rs *ReplicateService) GetCompletition(prompt string, systemPrompt string) (string, error) {
-	ctx := context.TODO()
-	model := "meta/meta-llama-3-70b-instruct:fbfb20b472b2f3bdd101412a9f70a0ed4fc0ced78a77ff00970ee7a2383c575d"
+// ModelID is the replicate model used for capability, it keys the cache
+func (rs *ReplicateService) ModelID(capability string) string {
+	switch capability {
+	case "text":
+		return "replicate/" + rs.Models.Text
+	case "speech":
+		return "replicate/" + rs.Models.Speech
+	case "transcription":
+		return "replicate/" + rs.Models.Transcription
+	default:
+		return "replicate/" + rs.Models.Images
+	}
+}
+
+func overrideFromEnv(value *string, name string) {
+	if env := os.Getenv(name); env != "" {
+		*value = env
+	}
+}
+
+func (rs *ReplicateService) GetCompletition(ctx context.Context, prompt string, systemPrompt string) (string, error) {
+	model := rs.Models.Text
 
 	if systemPrompt == "" {
-		systemPrompt = `
-    You are a creative storytelling AI designed to generate engaging, you create stories on the same language as the input, short-form stories suitable for TikTok's text-to-speech feature. Your task is to create captivating stories based on simple text prompts.
-    Guidelines:
-
-    Generate a story based on the given text prompt.
-    Keep the story concise, aiming for 60-120 seconds when read aloud.
-    Use vivid, descriptive language to engage the listener.
-    Ensure the story has a clear beginning, middle, and end.
-    Incorporate elements of surprise, humor, or emotional appeal when appropriate.
-    Use simple language and short sentences for easy listening.
-    Avoid explicit content, excessive violence, or controversial topics.
-    End with a hook or twist to encourage engagement.
-    The story can be either real (based on historical events or facts) or fictional, depending on the prompt.
-    Adapt your storytelling style to best fit the prompt.
-
-    Input:
-    [Text prompt]
-    Output:
-    [Generated story text only]
-    Remember to generate only the story text, without any additional elements like titles or hashtags. Create a story that would be engaging and suitable for TikTok's audience.
-    `
+		systemPrompt = DefaultStorySystemPrompt
 	}
 
 	input := replicate.PredictionInput{
@@ -56,7 +87,7 @@ func (rs *ReplicateService) GetCompletition(prompt string, systemPrompt string)
 		"max_tokens":    2000,
 	}
 
-	output, err := rs.Client.Run(ctx, model, input, nil)
+	output, err := rs.RunWithModel(ctx, model, input, nil)
 
 	if err != nil {
 		return "", err
@@ -72,15 +103,21 @@ func (rs *ReplicateService) GetCompletition(prompt string, systemPrompt string)
 
 }
 
-func (rs *ReplicateService) GetImages(prompt string, quantity int64) ([]string, error) {
-	ctx := context.TODO()
-	model := "black-forest-labs/flux-schnell"
+func (rs *ReplicateService) GetImages(ctx context.Context, prompt string, quantity int64, options ImageOptions) ([]string, error) {
+	model := rs.Models.Images
+
+	if options.AspectRatio == "" {
+		options.AspectRatio = "9:16"
+	}
 
 	input := replicate.PredictionInput{
 		"prompt":                 prompt,
 		"num_outputs":            quantity,
 		"disable_safety_checker": true,
-		"aspect_ratio":           "9:16",
+		"aspect_ratio":           options.AspectRatio,
+	}
+	if options.Seed != nil {
+		input["seed"] = *options.Seed
 	}
 
 	output, err := rs.RunWithModel(ctx, model, input, nil)
@@ -98,16 +135,30 @@ func (rs *ReplicateService) GetImages(prompt string, quantity int64) ([]string,
 	return stringsOutput, nil
 }
 
-func (rs *ReplicateService) GetVoice(text string) (string, error) {
-	ctx := context.TODO()
-	model := "lucataco/xtts-v2:49ff6cfa14bd4e7f80f62e2279f82f23dfc2e7970f825f8db5599f8a6213c009"
+func (rs *ReplicateService) GetVoice(ctx context.Context, text string, options VoiceOptions) (string, error) {
+	model := rs.Models.Speech
+
+	if options.Speaker == "" {
+		options.Speaker = defaultSpeaker
+	}
+
+	// uploaded voices are downloaded from our object store, which replicate may not reach
+	speaker, cleanup, err := rs.uploadLocal(ctx, options.Speaker)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload speaker: %w", err)
+	}
+	defer cleanup()
 
 	input := replicate.PredictionInput{
 		"text":    text,
-		"speaker": "https://replicate.delivery/pbxt/KMZ6fyOMKrtwERmDWAJnd5KRy39a86dgloX7SYP5dVTnQXjv/jacob.wav",
+		"speaker": speaker,
 	}
 
-	output, err := rs.Client.Run(ctx, model, input, nil)
+	if options.Language != "" {
+		input["language"] = options.Language
+	}
+
+	output, err := rs.RunWithModel(ctx, model, input, nil)
 
 	if err != nil {
 		return "", err
@@ -122,11 +173,33 @@ func (rs *ReplicateService) GetVoice(text string) (string, error) {
 	return strings.Join(stringOutput, ""), nil
 }
 
+// uploadLocal uploads a file:// URL through the replicate files API, replicate only takes URLs
+// it can fetch. Other URLs are returned as they are, cleanup deletes the upload
+func (rs *ReplicateService) uploadLocal(ctx context.Context, url string) (string, func(), error) {
+	path, ok := strings.CutPrefix(url, "file://")
+	if !ok {
+		return url, func() {}, nil
+	}
+
+	file, err := rs.Client.CreateFileFromPath(ctx, path, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return file.URLs["get"], func() { rs.Client.DeleteFile(context.Background(), file.ID) }, nil
+}
+
 //get transcription
 
-func (rs *ReplicateService) GetTranscription(audio string, initial string) (*models.TranscriptionOutput, error) {
-	ctx := context.TODO()
-	model := "victor-upmeet/whisperx:84d2ad2d6194fe98a17d2b60bef1c7f910c46b2f6fd38996ca457afd9c8abfcb"
+func (rs *ReplicateService) GetTranscription(ctx context.Context, audio string, initial string, language string) (*models.TranscriptionOutput, error) {
+	model := rs.Models.Transcription
+
+	// merged voices are local files
+	audio, cleanup, err := rs.uploadLocal(ctx, audio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload audio: %w", err)
+	}
+	defer cleanup()
 
 	input := replicate.PredictionInput{
 		"audio_file":     audio,
@@ -135,7 +208,16 @@ func (rs *ReplicateService) GetTranscription(audio string, initial string) (*mod
 		"offset_seconds": 0,
 	}
 
-	output, err := rs.Client.Run(ctx, model, input, nil)
+	if language != "" {
+		input["language"] = language
+	}
+
+	// biases recognition towards the script, alignment fixes whatever is still misheard
+	if initial != "" {
+		input["initial_prompt"] = initial
+	}
+
+	output, err := rs.RunWithModel(ctx, model, input, nil)
 
 	if err != nil {
 		println(err.Error())
@@ -188,61 +270,42 @@ func outputToStrings[T any](output T) []string {
 	}
 }
 
+// RunWithModel runs a prediction for a model, pinned to a version when the identifier has one,
+// and cancels it on Replicate if ctx is done before it finishes
 func (rs *ReplicateService) RunWithModel(ctx context.Context, identifier string, input replicate.PredictionInput, webhook *replicate.Webhook) (replicate.PredictionOutput, error) {
 	id, err := replicate.ParseIdentifier(identifier)
-
-	prediction, err := rs.Client.CreatePredictionWithModel(ctx, id.Owner, id.Name, input, nil, false)
-
 	if err != nil {
 		return nil, err
 	}
 
-	err = rs.Client.Wait(ctx, prediction)
+	var prediction *replicate.Prediction
+	if id.Version != nil {
+		prediction, err = rs.Client.CreatePrediction(ctx, *id.Version, input, webhook, false)
+	} else {
+		prediction, err = rs.Client.CreatePredictionWithModel(ctx, id.Owner, id.Name, input, webhook, false)
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return prediction.Output, nil
-}
-
-func (rs *ReplicateService) GetVoiceLarge(prompt string) ([]string, error) {
-	const maxTokens = 600 // Adjust this value based on your specific requirements
-	var result []string
-
-	words := strings.Fields(prompt)
-	var currentChunk []string
-	var tokenCount int
+	err = rs.Client.Wait(ctx, prediction)
 
-	for _, word := range words {
-		wordTokens := estimateTokens(word)
-		if tokenCount+wordTokens > maxTokens && len(currentChunk) > 0 {
-			voice, err := rs.GetVoice(strings.Join(currentChunk, " "))
-			if err != nil {
-				return nil, err
-			}
-			result = append(result, voice)
-			currentChunk = nil
-			tokenCount = 0
+	if ctx.Err() != nil {
+		// nobody is waiting for this output anymore, stop paying for it
+		if _, cancelErr := rs.Client.CancelPrediction(context.Background(), prediction.ID); cancelErr != nil {
+			log.Printf("failed to cancel prediction %s: %v", prediction.ID, cancelErr)
 		}
-
-		currentChunk = append(currentChunk, word)
-		tokenCount += wordTokens
+		return nil, ctx.Err()
 	}
 
-	if len(currentChunk) > 0 {
-		voice, err := rs.GetVoice(strings.Join(currentChunk, " "))
-		if err != nil {
-			return nil, err
-		}
-		result = append(result, voice)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
-}
+	if prediction.Error != nil {
+		return nil, &replicate.ModelError{Prediction: prediction}
+	}
 
-// estimateTokens is a simple function to estimate the number of tokens in a word
-// You may need to implement a more sophisticated tokenization method based on your specific requirements
-func estimateTokens(word string) int {
-	return len(word)/4 + 1 // A simple estimation, assuming on average 4 characters per token
+	return prediction.Output, nil
 }
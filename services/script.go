@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// StructuredScriptSystemPrompt asks for the story as JSON together with everything needed to publish it
+const StructuredScriptSystemPrompt = `
+    You are a creative storytelling AI that writes engaging short-form stories for TikTok's text-to-speech feature, in the same language as the input.
+    Keep the story concise, 60-120 seconds when read aloud, with simple language, short sentences, a clear beginning, middle and end, and a twist at the end.
+    Avoid explicit content, excessive violence, or controversial topics.
+
+    Answer with a single JSON object and nothing else, no markdown and no explanations:
+    {
+      "title": "a catchy title of at most 60 characters",
+      "hook": "the first sentence of the script, written to stop people from scrolling",
+      "script": "the full story exactly as it will be read aloud, starting with the hook, without titles, hashtags or stage directions",
+      "hashtags": ["3 to 8 hashtags without spaces"],
+      "scenes": [{"text": "the consecutive part of the script this scene covers", "visual": "what is on screen: subject, setting, camera and lighting"}],
+      "description": "one or two sentences to post the video with"
+    }
+    The scenes cover the whole script in order, use 3 to 8 of them.
+    `
+
+const (
+	// MaxScriptAttempts is how many times the text model is asked for valid JSON
+	MaxScriptAttempts = 3
+	maxHashtags       = 10
+	// maxTitleLength is in characters, StructuredScriptSystemPrompt asks for the same
+	maxTitleLength = 60
+)
+
+var (
+	trailingComma = regexp.MustCompile(`,\s*([}\]])`)
+	// "Here is your story:", "Sure! Here's a short story about robots:" and the like
+	preamble = regexp.MustCompile(`(?i)^(sure|okay|ok|certainly|of course|here is|here's|here are)\b[^\n]*:[ \t]*\n\s*`)
+	heading  = regexp.MustCompile(`(?im)^\s*(#+ .*|\*\*[^*.!?]+\*\*|title:.*)\s*$`)
+	hashtag  = regexp.MustCompile(`[^\p{L}\p{N}_]`)
+)
+
+// GenerateStructuredScript asks text for a structured script, an invalid answer is sent back with
+// the problem so the model can fix it, up to MaxScriptAttempts times
+func GenerateStructuredScript(ctx context.Context, text TextGenerator, prompt string) (*models.PredictionOutputFormat, error) {
+	var story *models.PredictionOutputFormat
+
+	err := askForJSON(ctx, text, prompt, StructuredScriptSystemPrompt, func(answer string) (err error) {
+		story, err = ParseStructuredScript(answer)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no valid structured script: %w", err)
+	}
+
+	return story, nil
+}
+
+// askForJSON sends prompt until parse accepts the answer, every rejected answer is sent back
+// with the reason so the model can fix it, up to MaxScriptAttempts times. Only the accepted
+// answer is cached, as the answer to prompt, so a retry never replays the rejected ones
+func askForJSON(ctx context.Context, text TextGenerator, prompt string, systemPrompt string, parse func(answer string) error) error {
+	request := prompt
+	var lastErr error
+
+	for attempt := 1; attempt <= MaxScriptAttempts; attempt++ {
+		answer, err := text.GetCompletition(withUncheckedAnswers(ctx), request, systemPrompt)
+		if err != nil {
+			return err
+		}
+
+		err = parse(answer)
+		if err == nil {
+			if cache, ok := text.(answerCache); ok {
+				cache.RememberCompletition(ctx, prompt, systemPrompt, answer)
+			}
+			return nil
+		}
+
+		lastErr = err
+		request = fmt.Sprintf("%s\n\nYour previous answer was:\n%s\n\nIt was rejected because %v. Answer again with only the corrected JSON object.", prompt, answer, err)
+	}
+
+	return fmt.Errorf("%d answers were invalid, the last one because %w", MaxScriptAttempts, lastErr)
+}
+
+// decodeJSON repairs the usual mistakes of text models around a JSON object, like markdown
+// fences, explanations and trailing commas, and decodes it into v
+func decodeJSON(answer string, v any) error {
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return errors.New("the answer has no JSON object")
+	}
+
+	raw := trailingComma.ReplaceAllString(answer[start:end+1], "$1")
+
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return fmt.Errorf("the JSON is invalid: %v", err)
+	}
+	return nil
+}
+
+// ParseStructuredScript repairs the JSON of the answer, then validates and normalizes the story
+func ParseStructuredScript(answer string) (*models.PredictionOutputFormat, error) {
+	var story models.PredictionOutputFormat
+	if err := decodeJSON(answer, &story); err != nil {
+		return nil, err
+	}
+
+	story.Title = strings.Trim(strings.TrimSpace(story.Title), `"`)
+	story.Hook = strings.TrimSpace(story.Hook)
+	story.Script = CleanScript(story.Script)
+	story.Description = strings.TrimSpace(story.Description)
+
+	if story.Script == "" {
+		return nil, errors.New("script is empty")
+	}
+	if story.Title == "" {
+		return nil, errors.New("title is empty")
+	}
+	if utf8.RuneCountInString(story.Title) > maxTitleLength {
+		return nil, fmt.Errorf("title is longer than %d characters", maxTitleLength)
+	}
+
+	// the hook is read first, a model that forgot to start with it gets it prepended
+	if story.Hook != "" && !strings.Contains(story.Script, story.Hook) {
+		story.Script = story.Hook + " " + story.Script
+	}
+
+	story.Hashtags = normalizeHashtags(story.Hashtags)
+
+	var scenes []models.Scene
+	for _, scene := range story.Scenes {
+		scene.Text = strings.TrimSpace(scene.Text)
+		scene.Visual = strings.TrimSpace(scene.Visual)
+		if scene.Visual != "" {
+			scenes = append(scenes, scene)
+		}
+	}
+	if len(scenes) == 0 {
+		return nil, errors.New("scenes has no scene with a visual")
+	}
+	story.Scenes = scenes
+
+	return &story, nil
+}
+
+// CleanScript removes what text models like to put around a story: preambles, headings,
+// markdown emphasis and wrapping quotes
+func CleanScript(script string) string {
+	script = strings.TrimSpace(script)
+	script = preamble.ReplaceAllString(script, "")
+	script = heading.ReplaceAllString(script, "")
+	script = strings.ReplaceAll(script, "**", "")
+	script = strings.TrimSpace(script)
+
+	if len(script) > 1 && strings.HasPrefix(script, `"`) && strings.HasSuffix(script, `"`) && strings.Count(script, `"`) == 2 {
+		script = script[1 : len(script)-1]
+	}
+
+	return strings.TrimSpace(script)
+}
+
+// normalizeHashtags writes the tags as #word without duplicates
+func normalizeHashtags(tags []string) []string {
+	seen := make(map[string]bool)
+	var hashtags []string
+
+	for _, tag := range tags {
+		tag = hashtag.ReplaceAllString(tag, "")
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		hashtags = append(hashtags, "#"+tag)
+
+		if len(hashtags) == maxHashtags {
+			break
+		}
+	}
+
+	return hashtags
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// scriptedText answers with the given completions in order and records the prompts
+type scriptedText struct {
+	answers []string
+	prompts []string
+}
+
+func (s *scriptedText) GetCompletition(ctx context.Context, prompt string, systemPrompt string) (string, error) {
+	s.prompts = append(s.prompts, prompt)
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	return answer, nil
+}
+
+func TestParseStructuredScriptRepairs(t *testing.T) {
+	answer := "Sure! Here is your story:\n```json\n{\n" +
+		`"title": "The Last Lamp",` +
+		`"hook": "Nobody had lit the lamp in years.",` +
+		`"script": "**The Last Lamp**\nThe keeper climbed the stairs one last time.",` +
+		`"hashtags": ["lighthouse", "#Story", "#story", "sea tales"],` +
+		`"scenes": [{"text": "The keeper climbed", "visual": "An old keeper on a spiral staircase"}, {"text": "", "visual": ""},],` +
+		`"description": "One last night at the lighthouse.",` +
+		"\n}\n```"
+
+	story, err := ParseStructuredScript(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if story.Script != "Nobody had lit the lamp in years. The keeper climbed the stairs one last time." {
+		t.Fatalf("expected a clean script starting with the hook, got %q", story.Script)
+	}
+	if strings.Join(story.Hashtags, " ") != "#lighthouse #Story #seatales" {
+		t.Fatalf("unexpected hashtags %v", story.Hashtags)
+	}
+	if len(story.Scenes) != 1 {
+		t.Fatalf("expected the empty scene to be dropped, got %+v", story.Scenes)
+	}
+}
+
+func TestGenerateStructuredScriptRetries(t *testing.T) {
+	text := &scriptedText{answers: []string{
+		"Once upon a time there was no JSON.",
+		`{"title": "", "script": "A story.", "scenes": [{"visual": "a field"}]}`,
+		`{"title": "Fixed", "script": "A story.", "scenes": [{"visual": "a field"}]}`,
+	}}
+
+	story, err := GenerateStructuredScript(context.Background(), text, "a field")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if story.Title != "Fixed" || len(text.prompts) != 3 {
+		t.Fatalf("expected the third answer after 3 prompts, got %+v after %d", story, len(text.prompts))
+	}
+	if !strings.Contains(text.prompts[2], "title is empty") {
+		t.Fatalf("expected the retry to explain the problem, got %q", text.prompts[2])
+	}
+
+	text = &scriptedText{answers: []string{"no", "still no", "never"}}
+	if _, err := GenerateStructuredScript(context.Background(), text, "x"); err == nil {
+		t.Fatal("expected an error after running out of attempts")
+	}
+}
+
+func TestCleanScript(t *testing.T) {
+	cleaned := CleanScript("Here's a short story about a robot:\n\n\"A robot woke up.\"")
+	if cleaned != "A robot woke up." {
+		t.Fatalf("unexpected script %q", cleaned)
+	}
+
+	if story := "Here is the thing: robots can't dream."; CleanScript(story) != story {
+		t.Fatalf("a story starting like a preamble on the same line should be kept, got %q", CleanScript(story))
+	}
+}
+
+func TestParseStructuredScriptCountsTitleCharacters(t *testing.T) {
+	// 40 characters but 120 bytes
+	title := strings.Repeat("夢", 40)
+	answer := `{"title": "` + title + `", "script": "A story.", "scenes": [{"visual": "a field"}]}`
+	if _, err := ParseStructuredScript(answer); err != nil {
+		t.Fatalf("expected a 40 character title to be accepted, got %v", err)
+	}
+
+	answer = `{"title": "` + strings.Repeat("a", maxTitleLength+1) + `", "script": "A story.", "scenes": [{"visual": "a field"}]}`
+	if _, err := ParseStructuredScript(answer); err == nil {
+		t.Fatal("expected a title longer than the prompt allows to be rejected")
+	}
+}
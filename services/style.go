@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+// StyleBibleSystemPrompt asks for the art direction every image of a story has to follow
+const StyleBibleSystemPrompt = `
+    You are the art director of an illustrated short video. Read the story and decide how every image of it will look,
+    so the same characters and places are recognizable from one image to the next.
+
+    Answer with a single JSON object and nothing else, no markdown and no explanations:
+    {
+      "art_style": "medium, technique and rendering, like flat vector illustration with soft shadows",
+      "palette": "the few colors that dominate every image",
+      "setting": "where and when the story happens, as it should look",
+      "characters": [{"name": "how the story calls them", "description": "a visual description to draw them the same way every time: age, build, face, hair, clothes"}]
+    }
+    Describe only what can be seen, in English, with at most 5 characters.
+    `
+
+const maxCharacters = 5
+
+// GenerateStyleBible asks text for the style bible of script. A preset fixes the art style and
+// palette, the model then only describes the characters and the setting
+func GenerateStyleBible(ctx context.Context, text TextGenerator, script string, preset *models.StylePreset) (*models.StyleBible, error) {
+	prompt := "Story:\n" + script
+	if preset != nil {
+		prompt += fmt.Sprintf("\n\nThe art style is %s and the palette is %s.", preset.ArtStyle, preset.Palette)
+	}
+
+	var bible *models.StyleBible
+	err := askForJSON(ctx, text, prompt, StyleBibleSystemPrompt, func(answer string) (err error) {
+		bible, err = ParseStyleBible(answer)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no valid style bible: %w", err)
+	}
+
+	if preset != nil {
+		bible.ArtStyle = preset.ArtStyle
+		bible.Palette = preset.Palette
+	}
+
+	return bible, nil
+}
+
+// ParseStyleBible repairs the JSON of the answer and drops the characters without a description
+func ParseStyleBible(answer string) (*models.StyleBible, error) {
+	var bible models.StyleBible
+	if err := decodeJSON(answer, &bible); err != nil {
+		return nil, err
+	}
+
+	bible.ArtStyle = strings.TrimSpace(bible.ArtStyle)
+	bible.Palette = strings.TrimSpace(bible.Palette)
+	bible.Setting = strings.TrimSpace(bible.Setting)
+
+	if bible.ArtStyle == "" {
+		return nil, errors.New("art_style is empty")
+	}
+
+	var characters []models.Character
+	for _, character := range bible.Characters {
+		character.Name = strings.TrimSpace(character.Name)
+		character.Description = strings.TrimSpace(character.Description)
+		if character.Name != "" && character.Description != "" {
+			characters = append(characters, character)
+		}
+	}
+	if len(characters) > maxCharacters {
+		characters = characters[:maxCharacters]
+	}
+	bible.Characters = characters
+
+	return &bible, nil
+}
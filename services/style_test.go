@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/thedekerone/shorts-maker/models"
+)
+
+func TestGenerateStyleBibleWithPreset(t *testing.T) {
+	text := &scriptedText{answers: []string{
+		"not json",
+		`{"art_style": "oil painting", "palette": "grey", "setting": "a foggy harbour",
+		  "characters": [{"name": "Keeper", "description": "an old man in a yellow raincoat"}, {"name": "Ghost"},]}`,
+	}}
+	preset, _ := models.Preset("watercolor")
+
+	bible, err := GenerateStyleBible(context.Background(), text, "The keeper climbed the stairs.", &preset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(text.prompts) != 2 || !strings.Contains(text.prompts[1], "rejected") {
+		t.Fatalf("expected the invalid answer to be sent back, got %q", text.prompts)
+	}
+	if bible.ArtStyle != preset.ArtStyle || bible.Palette != preset.Palette {
+		t.Fatalf("expected the preset to fix the art style and palette, got %+v", bible)
+	}
+	if len(bible.Characters) != 1 {
+		t.Fatalf("expected the character without a description to be dropped, got %+v", bible.Characters)
+	}
+
+	prompt := bible.Prompt()
+	for _, want := range []string{"watercolor painting", "a foggy harbour", "Keeper: an old man in a yellow raincoat."} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("expected %q in %q", want, prompt)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CustomVoicePrefix marks a voice that was uploaded through POST /replicate/voices
+const CustomVoicePrefix = "custom:"
+
+// Voice is a reference speaker the TTS model clones
+type Voice struct {
+	Name        string `json:"name"`
+	Language    string `json:"language"`
+	Gender      string `json:"gender"`
+	Description string `json:"description,omitempty"`
+	SampleURL   string `json:"sample_url"`
+}
+
+// VoiceCatalog is the list of voices jobs can pick by name
+type VoiceCatalog struct {
+	Voices []Voice
+}
+
+// DefaultVoiceCatalog only has the speaker GetVoice falls back to
+var DefaultVoiceCatalog = &VoiceCatalog{Voices: []Voice{
+	{Name: "jacob", Language: "en", Gender: "male", SampleURL: defaultSpeaker},
+}}
+
+// LoadVoiceCatalog reads a JSON array of voices
+func LoadVoiceCatalog(path string) (*VoiceCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var voices []Voice
+	if err := json.Unmarshal(data, &voices); err != nil {
+		return nil, fmt.Errorf("invalid voice catalog %s: %w", path, err)
+	}
+
+	for i, voice := range voices {
+		if voice.Name == "" || voice.SampleURL == "" {
+			return nil, fmt.Errorf("voice %d of %s needs a name and a sample_url", i, path)
+		}
+		if strings.HasPrefix(voice.Name, CustomVoicePrefix) {
+			return nil, fmt.Errorf("voice name %s uses the reserved %q prefix", voice.Name, CustomVoicePrefix)
+		}
+	}
+
+	return &VoiceCatalog{Voices: voices}, nil
+}
+
+// Get looks a voice up by name
+func (c *VoiceCatalog) Get(name string) (Voice, bool) {
+	for _, voice := range c.Voices {
+		if voice.Name == name {
+			return voice, true
+		}
+	}
+	return Voice{}, false
+}
+
+// CustomVoiceKey is the object name an uploaded reference WAV is stored under
+func CustomVoiceKey(id string) string {
+	return "voices/" + id + ".wav"
+}
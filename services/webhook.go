@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Shorts-Maker-Signature"
+	// TimestampHeader is when the delivery was signed, in unix seconds, receivers should
+	// reject old ones so a captured delivery can't be replayed
+	TimestampHeader = "X-Shorts-Maker-Timestamp"
+)
+
+// ErrPrivateCallback is returned for callbacks to loopback, link-local or private addresses,
+// they would let anyone submitting a job reach services on the internal network
+var ErrPrivateCallback = errors.New("callback host must be a public address")
+
+var webhookClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         dialWebhook,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	// a redirect could point anywhere, receivers have to answer themselves
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// dialWebhook refuses to connect to addresses that aren't public, the check happens on the
+// resolved address so a hostname can't be pointed somewhere else after validation
+func dialWebhook(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !webhookHostAllowed(host) {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ip, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(net.ParseIP(ip)) {
+				return ErrPrivateCallback
+			}
+			return nil
+		}
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+// webhookHostAllowed reports whether host is in WEBHOOK_ALLOWED_HOSTS, a comma separated list of
+// hosts that may be private, for receivers running next to the server
+func webhookHostAllowed(host string) bool {
+	for _, allowed := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func publicAddress(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// CheckCallbackHost resolves host and fails when any of its addresses isn't public, unless the
+// host is allowed by WEBHOOK_ALLOWED_HOSTS
+func CheckCallbackHost(ctx context.Context, host string) error {
+	if webhookHostAllowed(host) {
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve callback host: %w", err)
+	}
+
+	for _, address := range addresses {
+		if !publicAddress(address.IP) {
+			return ErrPrivateCallback
+		}
+	}
+	return nil
+}
+
+// SignPayload returns the value of SignatureHeader, an HMAC-SHA256 keyed with secret
+// of the timestamp, a dot and the body
+func SignPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PostWebhook sends body to url once, signed with secret, and returns the response status code,
+// any non 2xx response is reported as an error
+func PostWebhook(ctx context.Context, url, secret, event string, body []byte) (int, error) {
+	if secret == "" {
+		return 0, errors.New("webhooks are only sent signed, the secret is empty")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Shorts-Maker-Event", event)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, SignPayload(secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	// drain so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("callback responded %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
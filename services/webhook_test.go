@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPostWebhookSignsTimestamp(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	if _, err := PostWebhook(context.Background(), server.URL, "secret", "job.completed", []byte(`{"id":"1"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := header.Get(TimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Fatalf("expected a current unix timestamp, got %q", timestamp)
+	}
+	if header.Get(SignatureHeader) != SignPayload("secret", timestamp, body) {
+		t.Fatal("expected the signature to cover the timestamp and the body")
+	}
+	if header.Get(SignatureHeader) == SignPayload("secret", strconv.FormatInt(sent-600, 10), body) {
+		t.Fatal("expected a different timestamp to change the signature")
+	}
+}
+
+func TestPostWebhookRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the callback not to be delivered")
+	}))
+	defer server.Close()
+
+	if _, err := PostWebhook(context.Background(), server.URL, "secret", "job.completed", []byte(`{}`)); !errors.Is(err, ErrPrivateCallback) {
+		t.Fatalf("expected the loopback callback to be refused, got %v", err)
+	}
+
+	for _, host := range []string{"127.0.0.1", "10.0.0.8", "169.254.169.254", "::1"} {
+		if err := CheckCallbackHost(context.Background(), host); !errors.Is(err, ErrPrivateCallback) {
+			t.Errorf("expected %s to be rejected, got %v", host, err)
+		}
+	}
+	if err := CheckCallbackHost(context.Background(), "93.184.216.34"); err != nil {
+		t.Errorf("expected a public address to be accepted, got %v", err)
+	}
+}